@@ -5,5 +5,7 @@ import "context"
 
 // Insighter -- insight based on entry url
 type Insighter interface {
-	Insight(ctx context.Context)
+	// Insight - run once, result is returned even if err is not nil,
+	// containing whatever has been done before the failure
+	Insight(ctx context.Context) (*Result, error)
 }
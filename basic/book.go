@@ -2,11 +2,16 @@ package basic
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/asciimoo/colly"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
+	"github.com/shohi/goinsight/util"
+	"github.com/spf13/viper"
 )
 
 // reference, https://github.com/hunterhug/doubanbook30000
@@ -77,11 +82,36 @@ type Book struct {
 // DoubanInsighter - fetch book data from douban and conclude some insights
 var DoubanInsighter = &bookInsighter{URL: "https://book.douban.com/tag/"}
 
+func init() {
+	Register("book", func(v *viper.Viper, _ store.SeenStore) (Insighter, error) {
+		return NewBookInsighter(v)
+	})
+}
+
+// NewBookInsighter -- create new douban book insighter using configuration,
+// entry url defaults to DoubanInsighter's
+func NewBookInsighter(v *viper.Viper) (Insighter, error) {
+	var cfg config.BookConfig
+	err := v.Unmarshal(&cfg.CommonConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &bookInsighter{URL: DoubanInsighter.URL}
+	if cfg.URL != "" {
+		i.URL = cfg.URL
+	}
+
+	logger.Info(cfg)
+	return i, nil
+}
+
 // Insight - fetch book data
-func (i *bookInsighter) Insight(_ string) {
+func (i *bookInsighter) Insight(ctx context.Context) (*Result, error) {
+	result := NewResult()
 
-	// Instantiate default collector
-	c := colly.NewCollector()
+	// Instantiate collector bound to ctx
+	c := NewCollector(ctx, config.CommonConfig{}, result)
 
 	// Visit only domains: douban.com, book.douban.com
 	if len(i.Domains) > 0 {
@@ -106,14 +136,16 @@ func (i *bookInsighter) Insight(_ string) {
 	// c.OnResponse(
 
 	// Start scraping on https://book.douban.com
-	i.fetchTags()
-	for _, v := range i.Tags {
-		go func(l string) {
-			c.Visit(i.URL + l)
-		}(v)
+	if err := i.fetchTags(); err != nil {
+		result.AddError(ErrNetwork)
+		return result, err
 	}
+	util.ForEachLimit(ctx, i.Tags, config.DefaultConcurrency, func(l string) {
+		c.Visit(i.URL + l)
+	})
 
 	c.Wait()
+	return result, ctx.Err()
 }
 
 // ref https://github.com/PuerkitoBio/goquery for goquery's details
@@ -0,0 +1,208 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/asciimoo/colly"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/util"
+)
+
+// NewCollector - create collector with settings shared by all insighters.
+// Requests made by the collector are bound to ctx, no request is issued
+// once ctx is done. Politeness settings of cfg are applied to every domain.
+// Visited pages and errors are counted in res.
+func NewCollector(ctx context.Context, cfg config.CommonConfig, res *Result) *colly.Collector {
+	c := colly.NewCollector()
+
+	// Cache responses to prevent multiple download of pages
+	// even if the collector is restarted
+	c.CacheDir = cfg.CacheDir
+
+	// robots.txt is honored by transport, which shares the request's user agent
+	c.IgnoreRobotsTxt = true
+
+	// cookies are kept by transport, so that they are shared with downloads
+	// and saved between runs
+	c.DisableCookies()
+
+	rules, randomDelays := limitRules(cfg)
+	c.Limits(rules)
+
+	c.WithTransport(NewTransport(ctx, cfg, res, randomDelayFunc(rules, randomDelays)))
+
+	c.OnResponse(func(r *colly.Response) {
+		res.AddPage(len(r.Body))
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		kind := ErrNetwork
+		if ctx.Err() != nil {
+			kind = ErrCanceled
+		} else if r.StatusCode != 0 {
+			kind = ErrStatus
+		} else if ue, ok := err.(*url.Error); ok {
+			if ue.Err == util.ErrRobotsDisallowed {
+				kind = ErrRobots
+			} else if _, banned := ue.Err.(*util.BanError); banned {
+				kind = ErrBanned
+			}
+		}
+		// canceled and refused requests are not worth retrying later
+		if kind == ErrCanceled || kind == ErrRobots {
+			res.AddError(kind)
+		} else {
+			res.AddFailure(r.Request.URL.String(), kind, err)
+		}
+
+		logger.Infow("request error", "url", r.Request.URL.String(), "kind", kind, "error", err)
+	})
+
+	return c
+}
+
+// NewHTTPClient - client for requests made outside collectors, e.g. downloads,
+// sharing the transport settings of collectors
+func NewHTTPClient(ctx context.Context, cfg config.CommonConfig, res *Result) *http.Client {
+	return &http.Client{
+		Transport: NewTransport(ctx, cfg, res, randomDelayFunc(limitRules(cfg))),
+	}
+}
+
+type redirectKey struct{}
+
+// WithRedirectHook - ctx whose collectors and clients call fn with urls of each
+// redirect they follow, e.g. to tell a site sends them to a verification page
+func WithRedirectHook(ctx context.Context, fn func(from, to *url.URL)) context.Context {
+	return context.WithValue(ctx, redirectKey{}, fn)
+}
+
+// NewTransport - transport bound to ctx which sets configured headers and cookies,
+// rotates requests through proxies and honors robots.txt if configured, waits a
+// random delay of randomDelay(host) before each request, and retries failed ones.
+// Requests are kept logged in if ctx carries a session, share the in-memory
+// cookie jar ctx carries, see WithCookieJar, and redirects are told to the hook
+// set by WithRedirectHook. Proxy use is counted in res.
+func NewTransport(ctx context.Context, cfg config.CommonConfig, res *Result, randomDelay func(host string) time.Duration) http.RoundTripper {
+	var t http.RoundTripper = http.DefaultTransport
+
+	pool, err := ProxyPool(cfg.Proxy)
+	if err != nil {
+		logger.Errorw("invalid proxy settings, all requests will fail", "error", err)
+		t = errTransport{fmt.Errorf("invalid proxy settings: %v", err)}
+	} else if pool != nil {
+		t = util.ProxyTransport(pool, res.AddProxyUse)
+	}
+
+	if randomDelay != nil {
+		t = util.RandomDelayTransport(t, randomDelay)
+	}
+
+	t = util.RetryTransport(t, RetryPolicy(cfg.Retry))
+
+	if cfg.RespectRobotsTxt {
+		t = util.RobotsTransport(t)
+	}
+
+	var jar http.CookieJar
+	if cookieJar, err := cookieJarFrom(ctx, cfg); err != nil {
+		logger.Errorw("invalid cookie settings, all requests will fail", "error", err)
+		t = errTransport{fmt.Errorf("invalid cookie settings: %v", err)}
+	} else {
+		jar = cookieJar
+	}
+	t = util.HeaderTransport(t, headers(cfg), cfg.Cookie, cfg.UserAgents, jar)
+
+	if session := SessionFrom(ctx); session != nil {
+		t = util.SessionTransport(t, session)
+	}
+
+	if fn, ok := ctx.Value(redirectKey{}).(func(from, to *url.URL)); ok {
+		t = util.RedirectTransport(t, fn)
+	}
+
+	return util.ContextTransport(ctx, t)
+}
+
+// RetryPolicy - retry policy of cfg, empty settings fall back to util.DefaultRetryPolicy
+func RetryPolicy(cfg config.RetryConfig) util.RetryPolicy {
+	p := util.DefaultRetryPolicy
+
+	if cfg.MaxAttempts > 0 {
+		p.MaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.Backoff > 0 {
+		p.Backoff = cfg.Backoff
+	}
+	if cfg.MaxBackoff > 0 {
+		p.MaxBackoff = cfg.MaxBackoff
+	}
+	if cfg.Jitter > 0 {
+		p.Jitter = cfg.Jitter
+	}
+	if len(cfg.RetryStatus) > 0 {
+		p.RetryStatus = cfg.RetryStatus
+	}
+
+	return p
+}
+
+// randomDelayFunc - random delay of the first rule matching host
+func randomDelayFunc(rules []*colly.LimitRule, randomDelays []time.Duration) func(host string) time.Duration {
+	return func(host string) time.Duration {
+		for k, rule := range rules {
+			if rule.Match(host) {
+				return randomDelays[k]
+			}
+		}
+		return 0
+	}
+}
+
+// limitRules - colly limit rules of per-domain limits followed by the default one
+// matching all domains, if any politeness is set. A colly rule limits all requests
+// it matches together, so the default parallelism and delay are shared by every
+// domain it applies to. Random delays of rules are returned separately since
+// colly's LimitRule has no such setting.
+func limitRules(cfg config.CommonConfig) ([]*colly.LimitRule, []time.Duration) {
+	var rules []*colly.LimitRule
+	var randomDelays []time.Duration
+
+	for _, l := range cfg.Limits {
+		rule := &colly.LimitRule{
+			DomainGlob:  l.DomainGlob,
+			Delay:       l.Delay,
+			Parallelism: l.Parallelism,
+		}
+		if err := rule.Init(); err != nil {
+			logger.Errorw("invalid limit rule ignored", "domain_glob", l.DomainGlob, "error", err)
+			continue
+		}
+
+		rules = append(rules, rule)
+		randomDelays = append(randomDelays, l.RandomDelay)
+	}
+
+	if cfg.Delay > 0 || cfg.RandomDelay > 0 || cfg.Parallelism > 0 {
+		parallelism := cfg.Parallelism
+		if parallelism <= 0 {
+			parallelism = cfg.PageConcurrency()
+		}
+
+		rule := &colly.LimitRule{
+			DomainGlob:  "*",
+			Delay:       cfg.Delay,
+			Parallelism: parallelism,
+		}
+		rule.Init()
+
+		rules = append(rules, rule)
+		randomDelays = append(randomDelays, cfg.RandomDelay)
+	}
+
+	return rules, randomDelays
+}
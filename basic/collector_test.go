@@ -0,0 +1,127 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shohi/goinsight/config"
+)
+
+func TestLimitRules(t *testing.T) {
+	cfg := config.CommonConfig{
+		Delay: time.Second,
+		Limits: []config.LimitConfig{
+			{DomainGlob: "*.58.com", RandomDelay: 2 * time.Second, Parallelism: 2},
+			{DomainGlob: "[", Delay: time.Second},
+		},
+	}
+
+	rules, randomDelays := limitRules(cfg)
+	if len(rules) != 2 || len(randomDelays) != 2 {
+		t.Fatalf("expect invalid rule dropped and default appended, got %d rules", len(rules))
+	}
+	if !rules[0].Match("bj.58.com") || rules[0].Match("58.com.cn") || randomDelays[0] != 2*time.Second {
+		t.Errorf("unexpected per-domain rule: %+v", rules[0])
+	}
+	if !rules[1].Match("www.newsmth.net") || rules[1].Parallelism != config.DefaultConcurrency {
+		t.Errorf("unexpected default rule: %+v", rules[1])
+	}
+
+	if rules, _ = limitRules(config.CommonConfig{}); len(rules) != 0 {
+		t.Errorf("expect no rule without politeness settings, got %d", len(rules))
+	}
+}
+
+func TestCollectorPoliteness(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+			return
+		}
+
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	result := NewResult()
+	c := NewCollector(context.Background(), config.CommonConfig{
+		Parallelism:      1,
+		RespectRobotsTxt: true,
+	}, result)
+
+	var wg sync.WaitGroup
+	for k := 0; k < 4; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			c.Visit(fmt.Sprintf("%s/page/%d", ts.URL, k))
+		}(k)
+	}
+	wg.Wait()
+	c.Visit(ts.URL + "/private/1")
+
+	if maxInFlight != 1 {
+		t.Errorf("expect at most 1 request in flight, got %d", maxInFlight)
+	}
+	if result.PagesVisited != 4 || result.Errors[ErrRobots] != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestCookieJarPerRun(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			return
+		}
+		fmt.Fprint(w, r.Header.Get("Cookie"))
+	}))
+	defer ts.Close()
+
+	cookie := func(ctx context.Context) string {
+		resp, err := NewHTTPClient(ctx, config.CommonConfig{}, NewResult()).Get(ts.URL + "/check")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	run := WithCookieJar(context.Background())
+	resp, err := NewHTTPClient(run, config.CommonConfig{}, NewResult()).Get(ts.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if c := cookie(run); c != "session=1" {
+		t.Errorf("cookie of the same run == %q, want session=1", c)
+	}
+	if c := cookie(WithCookieJar(context.Background())); c != "" {
+		t.Errorf("cookie of another run == %q, want none", c)
+	}
+	if c := cookie(context.Background()); c != "" {
+		t.Errorf("cookie without run == %q, want none", c)
+	}
+}
@@ -0,0 +1,101 @@
+package basic
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/util"
+)
+
+var (
+	cookieJarsMu sync.Mutex
+	cookieJars   = make(map[string]*util.CookieJar)
+)
+
+// CookieJar - cookie jar of cfg, with cookies of CookieFile loaded.
+// Jars saved to a file are shared by sections with the same CookieJar and
+// live across runs, otherwise a new in-memory jar is created.
+func CookieJar(cfg config.CommonConfig) (*util.CookieJar, error) {
+	cookieJarsMu.Lock()
+	defer cookieJarsMu.Unlock()
+
+	if jar, ok := cookieJars[cfg.CookieJar]; ok && cfg.CookieJar != "" {
+		return jar, nil
+	}
+
+	jar, err := util.NewCookieJar(cfg.CookieJar)
+	if err != nil {
+		return nil, err
+	}
+
+	// loaded once, cookies refreshed by later responses are kept
+	if cfg.CookieFile != "" {
+		if err = jar.Load(cfg.CookieFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CookieJar != "" {
+		cookieJars[cfg.CookieJar] = jar
+	}
+	return jar, nil
+}
+
+type cookieJarKey struct{}
+
+// runJar - in-memory jar shared within ctx
+type runJar struct {
+	mu  sync.Mutex
+	jar *util.CookieJar
+}
+
+// WithCookieJar - ctx of one run of a section, whose collectors and clients share
+// an in-memory jar if CookieJar isn't set, so that they share sessions. The jar
+// is dropped with ctx, so sessions don't outlive the run.
+func WithCookieJar(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cookieJarKey{}, &runJar{})
+}
+
+// cookieJarFrom - jar of cfg, the in-memory one carried by ctx if there is one
+func cookieJarFrom(ctx context.Context, cfg config.CommonConfig) (*util.CookieJar, error) {
+	r, _ := ctx.Value(cookieJarKey{}).(*runJar)
+	if r == nil || cfg.CookieJar != "" {
+		return CookieJar(cfg)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.jar == nil {
+		jar, err := CookieJar(cfg)
+		if err != nil {
+			return nil, err
+		}
+		r.jar = jar
+	}
+	return r.jar, nil
+}
+
+type sessionKey struct{}
+
+// WithSession - ctx whose collectors and clients keep logged in session
+func WithSession(ctx context.Context, session *util.Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFrom - session carried by ctx, nil if none
+func SessionFrom(ctx context.Context) *util.Session {
+	session, _ := ctx.Value(sessionKey{}).(*util.Session)
+	return session
+}
+
+// headers - static headers of cfg
+func headers(cfg config.CommonConfig) http.Header {
+	h := make(http.Header, len(cfg.Headers))
+	for key, value := range cfg.Headers {
+		h.Set(key, value)
+	}
+	return h
+}
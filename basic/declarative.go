@@ -0,0 +1,420 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/asciimoo/colly"
+	"github.com/jinzhu/now"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/sink"
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
+)
+
+// DeclarativeInsighter - collect items from listing pages as declared in config,
+// fields are extracted by css selectors and written to configured outputs
+type DeclarativeInsighter struct {
+	Config config.DeclarativeConfig
+
+	fields  []*field
+	filters []*filter
+	keys    []int
+
+	seen store.SeenStore
+}
+
+type field struct {
+	config.FieldConfig
+	re *regexp.Regexp
+}
+
+type filter struct {
+	config.FilterConfig
+	index int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+var fieldTypes = map[string]bool{
+	"": true, "string": true, "int": true, "float": true,
+	"time": true, "unix": true, "unixms": true, "url": true,
+}
+
+func init() {
+	Register("declarative", func(v *viper.Viper, seen store.SeenStore) (Insighter, error) {
+		return NewDeclarativeInsighter(v, seen)
+	})
+}
+
+// NewDeclarativeInsighter -- create new DeclarativeInsighter using configuration,
+// collected items are remembered in seen
+func NewDeclarativeInsighter(v *viper.Viper, seen store.SeenStore) (*DeclarativeInsighter, error) {
+	var cfg config.DeclarativeConfig
+
+	// unmarshal direct fields
+	err := v.Unmarshal(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// unmarshal component
+	err = v.Unmarshal(&cfg.CommonConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &DeclarativeInsighter{Config: cfg, seen: seen}
+	if err = i.compile(); err != nil {
+		return nil, err
+	}
+
+	logger.Info(cfg)
+	return i, nil
+}
+
+// compile - check config and prepare fields and filters
+func (i *DeclarativeInsighter) compile() error {
+	cfg := i.Config
+	if cfg.URL == "" {
+		return errors.New("URL is empty")
+	}
+	if cfg.ItemSelector == "" {
+		return errors.New("ItemSelector is empty")
+	}
+	if len(cfg.Fields) == 0 {
+		return errors.New("no Fields declared")
+	}
+	if err := sink.Check(cfg.OutputFormats()); err != nil {
+		return err
+	}
+
+	index := make(map[string]int)
+	for k, fc := range cfg.Fields {
+		if fc.Name == "" {
+			return fmt.Errorf("name of field #%d is empty", k+1)
+		}
+		if _, dup := index[fc.Name]; dup {
+			return fmt.Errorf("field %q declared twice", fc.Name)
+		}
+		if !fieldTypes[fc.Type] {
+			return fmt.Errorf("field %q has unknown type %q", fc.Name, fc.Type)
+		}
+		index[fc.Name] = k
+
+		f := &field{FieldConfig: fc}
+		if fc.Regexp != "" {
+			re, err := regexp.Compile(fc.Regexp)
+			if err != nil {
+				return fmt.Errorf("field %q: %v", fc.Name, err)
+			}
+			f.re = re
+		}
+		i.fields = append(i.fields, f)
+	}
+
+	for _, name := range cfg.KeyFields {
+		k, ok := index[name]
+		if !ok {
+			return fmt.Errorf("unknown key field %q", name)
+		}
+		i.keys = append(i.keys, k)
+	}
+	if len(i.keys) == 0 {
+		for k := range i.fields {
+			i.keys = append(i.keys, k)
+		}
+	}
+
+	for _, fc := range cfg.Filters {
+		k, ok := index[fc.Field]
+		if !ok {
+			return fmt.Errorf("unknown filter field %q", fc.Field)
+		}
+		i.filters = append(i.filters, &filter{FilterConfig: fc, index: k, seen: make(map[string]bool)})
+	}
+
+	return nil
+}
+
+// Insight - collect declared items
+func (i *DeclarativeInsighter) Insight(ctx context.Context) (*Result, error) {
+	defer logger.Sync()
+
+	result := NewResult()
+	table := &sink.Table{}
+	for _, f := range i.fields {
+		table.Header = append(table.Header, f.Name)
+	}
+	// items new again are told apart only if they can be
+	status := i.Config.Seen != (config.SeenConfig{})
+	if status {
+		table.Header = append(table.Header, "status")
+	}
+	var mu sync.Mutex
+
+	// Instantiate collector bound to ctx
+	c := NewCollector(ctx, i.Config.CommonConfig, result)
+
+	if i.Config.NewCache {
+		os.RemoveAll(c.CacheDir)
+	}
+
+	// OnHTML must be set before Visit
+	c.OnHTML(i.Config.ItemSelector, func(e *colly.HTMLElement) {
+		row, err := i.extract(e)
+		result.AddParsed()
+		if err != nil {
+			result.AddError(ErrParse)
+			logger.Infow("parse item error", "url", e.Request.URL.String(), "error", err)
+			return
+		}
+
+		if !i.isValid(row) {
+			result.AddFiltered()
+			return
+		}
+
+		state, err := i.seen.MarkWithMeta(i.key(row), store.Meta{
+			Source: e.Request.URL.String(),
+			Hash:   hashRow(row),
+		})
+		if err != nil {
+			result.AddError(ErrDB)
+			logger.Info(err.Error())
+		}
+		if !state.IsNew() {
+			result.AddDuplicate()
+			return
+		}
+		if status {
+			row = append(row, string(state))
+		}
+
+		result.AddNew()
+		mu.Lock()
+		table.Rows = append(table.Rows, row)
+		mu.Unlock()
+	})
+
+	// Start scrapping
+	p := NewPaginator(i.Config.URL, i.Config.Pagination, config.PaginationConfig{})
+	p.Client = NewHTTPClient(ctx, i.Config.CommonConfig, result)
+	err := p.Visit(ctx, c, i.Config.PageConcurrency())
+	if err != nil && ctx.Err() == nil {
+		logger.Infow("fail to get page list", "error", err)
+		result.AddError(ErrNetwork)
+		return result, fmt.Errorf("fail to get page list: %v", err)
+	}
+
+	// Output result
+	if len(table.Rows) == 0 {
+		logger.Info("final data is empty")
+		return result, ctx.Err()
+	}
+
+	if i.Config.NewDownload {
+		os.RemoveAll(i.Config.DownloadDir)
+	}
+
+	prefix := i.Config.OutputPrefix
+	if prefix == "" {
+		prefix = "items_"
+	}
+	if err = WriteTable(i.Config.CommonConfig, prefix, table, result); err != nil {
+		return result, err
+	}
+
+	return result, ctx.Err()
+}
+
+// extract - values of declared fields, error if a required field is missing
+func (i *DeclarativeInsighter) extract(e *colly.HTMLElement) ([]interface{}, error) {
+	row := make([]interface{}, 0, len(i.fields))
+
+	for _, f := range i.fields {
+		s := e.DOM
+		if f.Selector != "" {
+			s = s.Find(f.Selector).First()
+		}
+
+		raw := f.text(s)
+		if raw == "" {
+			if f.Required {
+				return nil, fmt.Errorf("field %q is empty", f.Name)
+			}
+			row = append(row, nil)
+			continue
+		}
+
+		v, err := f.convert(raw, e.Request)
+		if err != nil {
+			if f.Required {
+				return nil, fmt.Errorf("field %q: %v", f.Name, err)
+			}
+			logger.Infow("convert field error", "field", f.Name, "value", raw, "error", err)
+			v = nil
+		}
+		row = append(row, v)
+	}
+
+	return row, nil
+}
+
+func (f *field) text(s *goquery.Selection) string {
+	var raw string
+	if f.Attr != "" {
+		raw, _ = s.Attr(f.Attr)
+	} else {
+		raw = s.Text()
+	}
+	raw = strings.TrimSpace(raw)
+
+	if f.re != nil {
+		m := f.re.FindStringSubmatch(raw)
+		switch {
+		case m == nil:
+			raw = ""
+		case len(m) > 1:
+			raw = strings.TrimSpace(m[1])
+		default:
+			raw = m[0]
+		}
+	}
+
+	return raw
+}
+
+func (f *field) convert(raw string, req *colly.Request) (interface{}, error) {
+	switch f.Type {
+	case "int":
+		return strconv.Atoi(raw)
+	case "float":
+		return strconv.ParseFloat(raw, 64)
+	case "time":
+		if f.Layout != "" {
+			return time.ParseInLocation(f.Layout, raw, time.Local)
+		}
+		return now.Parse(raw)
+	case "unix", "unixms":
+		ut, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if f.Type == "unixms" {
+			return time.Unix(ut/1000, ut%1000*int64(time.Millisecond)), nil
+		}
+		return time.Unix(ut, 0), nil
+	case "url":
+		return req.AbsoluteURL(raw), nil
+	default:
+		return raw, nil
+	}
+}
+
+func (i *DeclarativeInsighter) isValid(row []interface{}) bool {
+	for _, f := range i.filters {
+		if !f.pass(row[f.index]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filter) pass(v interface{}) bool {
+	str := ""
+	if v != nil {
+		str = fmt.Sprint(v)
+	}
+
+	if len(f.In) > 0 && !contains(f.In, str) {
+		return false
+	}
+	if contains(f.NotIn, str) {
+		return false
+	}
+	for _, sub := range f.NotContains {
+		if strings.Contains(str, sub) {
+			return false
+		}
+	}
+
+	if f.Min != nil || f.Max != nil {
+		var num float64
+		switch val := v.(type) {
+		case int:
+			num = float64(val)
+		case float64:
+			num = val
+		default:
+			return false
+		}
+		if (f.Min != nil && num < *f.Min) || (f.Max != nil && num > *f.Max) {
+			return false
+		}
+	}
+
+	if f.MaxAge > 0 {
+		t, ok := v.(time.Time)
+		if !ok || t.Add(f.MaxAge).Before(time.Now()) {
+			return false
+		}
+	}
+
+	if f.Unique {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.seen[str] {
+			return false
+		}
+		f.seen[str] = true
+	}
+
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// key - key of the item to tell whether it is seen
+func (i *DeclarativeInsighter) key(row []interface{}) string {
+	parts := make([]string, 0, len(i.keys))
+	for _, k := range i.keys {
+		v := row[k]
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(sink.TimeLayout)
+		}
+		if v == nil {
+			v = ""
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, "_")
+}
+
+// hashRow - hash of the fields of row telling whether the item changed,
+// times are left out as they change whenever the item is bumped
+func hashRow(row []interface{}) string {
+	content := make([]interface{}, 0, len(row))
+	for _, v := range row {
+		if _, ok := v.(time.Time); !ok {
+			content = append(content, v)
+		}
+	}
+	return store.Hash(content)
+}
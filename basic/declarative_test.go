@@ -0,0 +1,128 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
+)
+
+const declarativeTOML = `
+[listing]
+Insighter = "declarative"
+ItemSelector = "ul.list li"
+KeyFields = ["title"]
+Outputs = ["csv"]
+OutputPrefix = "list_"
+
+[listing.Pagination]
+CountSelector = "div.pages a"
+
+[[listing.Fields]]
+Name = "title"
+Selector = "a"
+Required = true
+
+[[listing.Fields]]
+Name = "href"
+Selector = "a"
+Attr = "href"
+Type = "url"
+
+[[listing.Fields]]
+Name = "price"
+Selector = "b"
+Regexp = '(\d+)元'
+Type = "int"
+
+[[listing.Fields]]
+Name = "last"
+Attr = "data-time"
+Type = "unixms"
+
+[[listing.Filters]]
+Field = "price"
+Max = 3000.0
+
+[[listing.Filters]]
+Field = "last"
+MaxAge = "24h"
+`
+
+func TestDeclarativeInsighter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "declarative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recent := time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond)
+	old := time.Now().Add(-48*time.Hour).UnixNano() / int64(time.Millisecond)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := strings.Trim(r.URL.Path, "/")
+		fmt.Fprintf(w, `<html><body><ul class="list">
+			<li data-time="%d"><a href="/item/%s-1"> cheap %s </a><b>2000元/月</b></li>
+			<li data-time="%d"><a href="/item/%s-2">expensive %s</a><b>5000元/月</b></li>
+			<li data-time="%d"><a href="/item/%s-3">old %s</a><b>1000元/月</b></li>
+			<li data-time="%d"><a href="/item/dup">cheap 1</a><b>2000元/月</b></li>
+			<li data-time="%d"><span>no title</span></li>
+		</ul><div class="pages"><a>1</a><a>2</a></div></body></html>`,
+			recent, page, page, recent, page, page, old, page, page, recent, recent)
+	}))
+	defer ts.Close()
+
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err = v.ReadConfig(strings.NewReader(declarativeTOML)); err != nil {
+		t.Fatal(err)
+	}
+	sub := v.Sub("listing")
+	sub.Set("URL", ts.URL+"/%d/")
+	sub.Set("DownloadDir", dir)
+	sub.Set("Concurrency", 1)
+
+	i, err := New("listing", sub, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := i.Insight(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.PagesVisited != 2 || res.ItemsParsed != 10 || res.ItemsNew != 2 ||
+		res.ItemsFiltered != 4 || res.ItemsDuplicate != 2 || res.Errors[ErrParse] != 2 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	if len(res.Outputs) != 1 {
+		t.Fatalf("expect one output, got %v", res.Outputs)
+	}
+	data, _ := ioutil.ReadFile(res.Outputs[0])
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || lines[0] != "title,href,price,last" ||
+		!strings.HasPrefix(lines[1], "cheap ") || !strings.Contains(lines[1], ts.URL+"/item/") ||
+		strings.Contains(string(data), "/item/dup") {
+		t.Errorf("unexpected output:\n%s", data)
+	}
+}
+
+func TestDeclarativeConfigError(t *testing.T) {
+	v := viper.New()
+	v.Set("URL", "http://example.com/")
+	v.Set("ItemSelector", "li")
+	v.Set("Fields", []map[string]interface{}{{"Name": "a", "Type": "decimal"}})
+
+	if _, err := NewDeclarativeInsighter(v, store.NewMemory()); err == nil || !strings.Contains(err.Error(), "unknown type") {
+		t.Errorf("expect unknown type error, got %v", err)
+	}
+}
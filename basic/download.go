@@ -0,0 +1,33 @@
+package basic
+
+import (
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/media"
+	"github.com/shohi/goinsight/util"
+)
+
+// DownloadOptions - download settings of cfg, existing files are kept
+func DownloadOptions(cfg config.CommonConfig) util.DownloadOptions {
+	return util.DownloadOptions{
+		MaxSize:  cfg.MaxDownloadSize,
+		Checksum: cfg.Checksum,
+	}
+}
+
+// DedupeOptions - dedupe settings of cfg
+func DedupeOptions(cfg config.CommonConfig) media.Options {
+	return media.Options{
+		Action:     cfg.Dedupe.Action,
+		Similarity: cfg.Dedupe.Similarity,
+	}
+}
+
+// ProcessOptions - image processing settings of cfg
+func ProcessOptions(cfg config.CommonConfig) media.ProcessOptions {
+	return media.ProcessOptions{
+		MinWidth:  cfg.PostProcess.MinWidth,
+		MinHeight: cfg.PostProcess.MinHeight,
+		MinBytes:  cfg.PostProcess.MinBytes,
+		Thumbnail: cfg.PostProcess.Thumbnail,
+	}
+}
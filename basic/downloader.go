@@ -0,0 +1,456 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/media"
+	"github.com/shohi/goinsight/util"
+)
+
+// Default settings of Downloader
+const (
+	DefaultDownloadWorkers = 4
+	DefaultDownloadPerHost = 2
+	DefaultDownloadQueue   = 64
+)
+
+// progressInterval - interval of progress lines printed to terminal
+const progressInterval = time.Second
+
+// Download - a resource to download
+type Download struct {
+	URL string
+	// file is saved in Dir as named by util.ResourceName,
+	// or to `<Base><Ext>` if Base is set, see util.DownloadAs
+	Dir  string
+	Base string
+	Ext  string
+
+	// where the resource comes from, recorded in manifest with post-processing enabled
+	Source media.Source
+
+	// Done - called once the download ends, err is nil if the file is downloaded
+	// or exists, or if it was removed after an earlier download, in which case fp
+	// is empty. Optional.
+	Done func(fp string, n int64, err error)
+}
+
+// Downloader - queue of downloads served by a bounded number of workers,
+// with at most PerHost downloads from the same host at a time. Enqueue blocks
+// once the queue is full, so that crawling can't run far ahead of downloading.
+// Bytes and failures are counted in the result, and progress is printed to
+// stderr if it is a terminal. With post-processing enabled, downloaded images
+// are filtered by size and recorded in manifests, and with dedupe enabled they
+// are checked against those under DownloadDir. Downloads removed by either are
+// recorded in DownloadDir and aren't made again by later runs. Manifests, the
+// dedupe report, hashes of images and the record of removals are written on Wait.
+type Downloader struct {
+	ctx       context.Context
+	client    *http.Client
+	opts      util.DownloadOptions
+	res       *Result
+	perHost   int
+	index     *media.Index
+	processor *media.Processor
+	removals  *media.Removals
+
+	queue chan *Download
+	wg    sync.WaitGroup
+	once  sync.Once
+
+	mu     sync.Mutex
+	hosts  map[string]chan struct{}
+	stats  DownloadStats
+	queued int
+	start  time.Time
+
+	progress     io.Writer
+	stopProgress chan struct{}
+	progressDone chan struct{}
+}
+
+// NewDownloader - create downloader with settings of cfg, downloads are sent with
+// client and refused once ctx is done. Workers are started right away.
+func NewDownloader(ctx context.Context, cfg config.CommonConfig, client *http.Client, res *Result) *Downloader {
+	workers := cfg.DownloadWorkers
+	if workers <= 0 {
+		workers = DefaultDownloadWorkers
+	}
+	perHost := cfg.DownloadPerHost
+	if perHost <= 0 {
+		perHost = DefaultDownloadPerHost
+	}
+	queue := cfg.DownloadQueue
+	if queue <= 0 {
+		queue = DefaultDownloadQueue
+	}
+
+	d := &Downloader{
+		ctx:     ctx,
+		client:  client,
+		opts:    DownloadOptions(cfg),
+		res:     res,
+		perHost: perHost,
+		queue:   make(chan *Download, queue),
+		hosts:   make(map[string]chan struct{}),
+		start:   time.Now(),
+	}
+
+	if cfg.PostProcess.Enabled {
+		d.processor = media.NewProcessor(ProcessOptions(cfg))
+	}
+
+	if cfg.Dedupe.Enabled && cfg.DownloadDir != "" {
+		index, err := media.NewIndex(cfg.DownloadDir, DedupeOptions(cfg))
+		if err != nil {
+			logger.Infow("dedupe disabled", "dir", cfg.DownloadDir, "error", err)
+		}
+		d.index = index
+	}
+
+	if (d.processor != nil || d.index != nil) && cfg.DownloadDir != "" {
+		removals, err := media.LoadRemovals(cfg.DownloadDir)
+		if err != nil {
+			logger.Infow("invalid record of removed downloads", "dir", cfg.DownloadDir, "error", err)
+		}
+		d.removals = removals
+	}
+
+	if isTerminal(os.Stderr) {
+		d.progress = os.Stderr
+		d.stopProgress = make(chan struct{})
+		d.progressDone = make(chan struct{})
+		go d.printProgress()
+	}
+
+	d.wg.Add(workers)
+	for k := 0; k < workers; k++ {
+		go d.work()
+	}
+
+	return d
+}
+
+// Enqueue - queue download, blocks while the queue is full. A download removed
+// after an earlier one is skipped without being queued. Returns false if it is
+// refused since ctx is done.
+func (d *Downloader) Enqueue(dl *Download) bool {
+	if d.ctx.Err() != nil {
+		return false
+	}
+
+	if d.removals != nil && d.removals.Has(dl.URL) {
+		d.mu.Lock()
+		d.stats.Skipped++
+		d.mu.Unlock()
+
+		if dl.Done != nil {
+			dl.Done("", 0, nil)
+		}
+		return true
+	}
+
+	d.mu.Lock()
+	d.queued++
+	d.mu.Unlock()
+
+	select {
+	case d.queue <- dl:
+		return true
+	case <-d.ctx.Done():
+		d.mu.Lock()
+		d.queued--
+		d.mu.Unlock()
+		return false
+	}
+}
+
+// Wait - wait for queued downloads to end and record stats in the result,
+// no download can be queued afterwards
+func (d *Downloader) Wait() DownloadStats {
+	d.once.Do(func() {
+		close(d.queue)
+		d.wg.Wait()
+
+		if d.progress != nil {
+			close(d.stopProgress)
+			<-d.progressDone
+		}
+
+		d.mu.Lock()
+		d.stats.Duration = time.Since(d.start)
+		d.mu.Unlock()
+
+		d.res.SetDownloads(d.Stats())
+
+		if d.processor != nil {
+			written, err := d.processor.WriteManifests()
+			for _, fp := range written {
+				d.res.AddOutput(fp)
+			}
+			if err != nil {
+				d.res.AddError(ErrOutput)
+				logger.Infow("failed to write manifest", "error", err)
+			}
+		}
+
+		if d.removals != nil {
+			if fp, err := d.removals.Write(); err != nil {
+				d.res.AddError(ErrOutput)
+				logger.Infow("failed to write removed downloads", "file", fp, "error", err)
+			}
+		}
+
+		if d.index != nil {
+			fp, err := d.index.WriteReport()
+			if err != nil {
+				d.res.AddError(ErrOutput)
+				logger.Infow("failed to write dedupe report", "file", fp, "error", err)
+			} else {
+				d.res.AddOutput(fp)
+			}
+
+			if fp, err := d.index.Save(); err != nil {
+				d.res.AddError(ErrOutput)
+				logger.Infow("failed to save image hashes", "file", fp, "error", err)
+			}
+		}
+	})
+
+	return d.Stats()
+}
+
+// Stats - downloads so far
+func (d *Downloader) Stats() DownloadStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s := d.stats
+	s.Queued = d.queued
+	if s.Duration == 0 {
+		s.Duration = time.Since(d.start)
+	}
+	return s
+}
+
+func (d *Downloader) work() {
+	defer d.wg.Done()
+
+	for dl := range d.queue {
+		fp, n, err := d.download(dl)
+
+		var p processed
+		if err == nil {
+			p = d.process(dl, fp, n)
+		}
+
+		d.mu.Lock()
+		d.queued--
+		d.stats.Bytes += n
+		switch {
+		case err != nil:
+			d.stats.Failed++
+		case n == 0:
+			d.stats.Skipped++
+		default:
+			d.stats.Done++
+		}
+		if p.dropped {
+			d.stats.Dropped++
+		}
+		if p.duplicate {
+			d.stats.Duplicates++
+		}
+		if p.similar {
+			d.stats.Similar++
+		}
+		d.mu.Unlock()
+
+		d.res.AddBytes(n)
+		if err != nil {
+			if d.ctx.Err() != nil {
+				d.res.AddError(ErrCanceled)
+			} else {
+				d.res.AddFailure(dl.URL, ErrDownload, err)
+				logger.Infow("failed to download", "url", dl.URL, "error", err)
+			}
+		}
+
+		if dl.Done != nil {
+			dl.Done(fp, n, err)
+		}
+	}
+}
+
+// processed - outcome of processing a download
+type processed struct {
+	dropped   bool // under min size
+	duplicate bool
+	similar   bool
+}
+
+// process - post-process and dedupe file fp downloaded with n bytes. Existing files
+// are post-processed if they aren't in manifest yet, e.g. downloaded by an earlier
+// run with post-processing disabled.
+func (d *Downloader) process(dl *Download, fp string, n int64) processed {
+	var p processed
+
+	if d.processor != nil && (n > 0 || !d.processor.Has(fp)) {
+		src := dl.Source
+		src.URL = dl.URL
+
+		_, err := d.processor.Process(fp, src)
+		if err == media.ErrTooSmall {
+			if d.removals != nil {
+				d.removals.Add(dl.URL, fp, media.RemovedTooSmall)
+			}
+			p.dropped = true
+			return p
+		}
+		if err != nil {
+			logger.Infow("failed to process", "file", fp, "error", err)
+		}
+	}
+
+	if n > 0 && d.index != nil {
+		dup, similar, err := d.index.Add(fp)
+		if err != nil {
+			logger.Infow("failed to dedupe", "file", fp, "error", err)
+		}
+		if dup != nil && dup.Action == media.ActionSkip {
+			if d.processor != nil {
+				d.processor.Forget(fp)
+			}
+			if d.removals != nil {
+				d.removals.Add(dl.URL, fp, media.RemovedDuplicate)
+			}
+		}
+		p.duplicate, p.similar = dup != nil, len(similar) > 0
+	}
+
+	return p
+}
+
+func (d *Downloader) download(dl *Download) (string, int64, error) {
+	// queued downloads are dropped once ctx is done
+	if err := d.ctx.Err(); err != nil {
+		return "", 0, err
+	}
+
+	sem := d.host(dl.URL)
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-d.ctx.Done():
+		return "", 0, d.ctx.Err()
+	}
+
+	if dl.Base != "" {
+		return util.DownloadAs(d.client, dl.URL, dl.Base, dl.Ext, d.opts)
+	}
+	return util.DownloadResource(d.client, dl.URL, dl.Dir, d.opts)
+}
+
+// host - semaphore limiting downloads from host of rawURL
+func (d *Downloader) host(rawURL string) chan struct{} {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sem, ok := d.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, d.perHost)
+		d.hosts[host] = sem
+	}
+	return sem
+}
+
+func (d *Downloader) printProgress() {
+	defer close(d.progressDone)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprintf(d.progress, "\r%s   ", d.Stats())
+		case <-d.stopProgress:
+			fmt.Fprintf(d.progress, "\r%s   \n", d.Stats())
+			return
+		}
+	}
+}
+
+// isTerminal - whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// DownloadStats - downloads made by Downloader in one run
+type DownloadStats struct {
+	Done    int
+	Skipped int // file exists, or was removed after an earlier download
+	Failed  int
+	Queued  int
+	Bytes   int64
+	// downloaded images removed as under min size, counted with post-processing enabled
+	Dropped int
+	// downloaded images identical or similar to existing ones, counted with dedupe enabled
+	Duplicates int
+	Similar    int
+	// from creation of the downloader to its end
+	Duration time.Duration
+}
+
+// Total - number of finished downloads
+func (s DownloadStats) Total() int {
+	return s.Done + s.Skipped + s.Failed
+}
+
+// Rate - bytes per second
+func (s DownloadStats) Rate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+func (s DownloadStats) String() string {
+	str := fmt.Sprintf("downloads: done=%d skipped=%d failed=%d queued=%d bytes=%s rate=%s/s",
+		s.Done, s.Skipped, s.Failed, s.Queued, formatBytes(float64(s.Bytes)), formatBytes(s.Rate()))
+	if s.Dropped > 0 {
+		str += fmt.Sprintf(" dropped=%d", s.Dropped)
+	}
+	if s.Duplicates > 0 || s.Similar > 0 {
+		str += fmt.Sprintf(" duplicates=%d similar=%d", s.Duplicates, s.Similar)
+	}
+	return str
+}
+
+// formatBytes - size in human readable form, e.g. `1.5MB`
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	k := 0
+	for n >= 1024 && k < len(units)-1 {
+		n /= 1024
+		k++
+	}
+	if k == 0 {
+		return fmt.Sprintf("%.0f%s", n, units[k])
+	}
+	return fmt.Sprintf("%.1f%s", n, units[k])
+}
@@ -0,0 +1,136 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/media"
+)
+
+func TestDownloader(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == "/missing.jpg" {
+			http.NotFound(w, r)
+		} else {
+			w.Write([]byte("image"))
+		}
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "downloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CommonConfig{DownloadWorkers: 4, DownloadPerHost: 2, DownloadQueue: 1}
+
+	run := func() (*Result, int) {
+		res := NewResult()
+		d := NewDownloader(context.Background(), cfg, &http.Client{}, res)
+
+		var done int
+		var doneMu sync.Mutex
+		for k := 0; k < 8; k++ {
+			d.Enqueue(&Download{
+				URL: fmt.Sprintf("%s/%d.jpg", ts.URL, k),
+				Dir: dir,
+				Done: func(fp string, n int64, err error) {
+					doneMu.Lock()
+					done++
+					doneMu.Unlock()
+				},
+			})
+		}
+		d.Enqueue(&Download{URL: ts.URL + "/missing.jpg", Dir: dir})
+		d.Wait()
+
+		return res, done
+	}
+
+	res, done := run()
+	s := res.Downloads
+	if s.Done != 8 || s.Failed != 1 || s.Skipped != 0 || s.Queued != 0 || s.Bytes != 40 || done != 8 {
+		t.Errorf("first run == %+v with %d callbacks", s, done)
+	}
+	if len(res.Failures) != 1 || res.BytesDownloaded != 40 {
+		t.Errorf("result has %d failures and %d bytes, want 1 and 40", len(res.Failures), res.BytesDownloaded)
+	}
+	if maxInFlight > cfg.DownloadPerHost {
+		t.Errorf("max downloads in flight == %d, want at most %d", maxInFlight, cfg.DownloadPerHost)
+	}
+
+	// existing files are skipped
+	if res, _ = run(); res.Downloads.Skipped != 8 || res.Downloads.Done != 0 {
+		t.Errorf("second run == %+v, want 8 skipped", res.Downloads)
+	}
+}
+
+func TestDownloaderRemoved(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte("image"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "downloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CommonConfig{DownloadDir: dir, DownloadWorkers: 1}
+	cfg.Dedupe.Enabled, cfg.Dedupe.Action = true, media.ActionSkip
+
+	run := func(paths ...string) DownloadStats {
+		d := NewDownloader(context.Background(), cfg, &http.Client{}, NewResult())
+		for _, p := range paths {
+			d.Enqueue(&Download{URL: ts.URL + p, Dir: dir})
+		}
+		return d.Wait()
+	}
+
+	if s := run("/a/1.jpg", "/b/1.jpg"); s.Done != 2 || s.Duplicates != 1 {
+		t.Errorf("first run == %+v, want 2 done with 1 duplicate", s)
+	}
+
+	// the duplicate removed isn't downloaded again
+	if s := run("/a/1.jpg", "/b/1.jpg"); s.Skipped != 2 || s.Done != 0 || hits["/b/1.jpg"] != 1 {
+		t.Errorf("second run == %+v with hits %v, want 2 skipped", s, hits)
+	}
+
+	// nor is an image dropped as too small
+	cfg.PostProcess.Enabled, cfg.PostProcess.MinBytes = true, 100
+	if s := run("/c/2.jpg"); s.Dropped != 1 {
+		t.Errorf("run with min size == %+v, want 1 dropped", s)
+	}
+	if s := run("/c/2.jpg"); s.Skipped != 1 || hits["/c/2.jpg"] != 1 {
+		t.Errorf("run after drop == %+v with hits %v, want 1 skipped", s, hits)
+	}
+}
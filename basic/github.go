@@ -1,10 +1,14 @@
 package basic
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/asciimoo/colly"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
 )
 
 type cvsInsighter struct {
@@ -16,11 +20,37 @@ type cvsInsighter struct {
 // GithubInsighter -- search repos in github
 var GithubInsighter = &cvsInsighter{"https://github.com/search?q=", ":", "+"}
 
-// InsightGithub - fetch github repos' stared and forking data
+func init() {
+	Register("github", func(v *viper.Viper, _ store.SeenStore) (Insighter, error) {
+		return NewGithubInsighter(v)
+	})
+}
+
+// NewGithubInsighter -- create new github insighter using configuration,
+// search url defaults to GithubInsighter's
+func NewGithubInsighter(v *viper.Viper) (Insighter, error) {
+	var cfg config.CommonConfig
+	err := v.Unmarshal(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	i := *GithubInsighter
+	if cfg.URL != "" {
+		i.BaseURL = cfg.URL
+	}
+
+	logger.Info(cfg)
+	return &i, nil
+}
+
+// Insight - fetch github repos' stared and forking data
 // and conclude some insights
-func (i *cvsInsighter) Insight(_ string) {
-	// Instantiate default collector
-	c := colly.NewCollector()
+func (i *cvsInsighter) Insight(ctx context.Context) (*Result, error) {
+	result := NewResult()
+
+	// Instantiate collector bound to ctx
+	c := NewCollector(ctx, config.CommonConfig{}, result)
 
 	// Visit only domains: douban.com, book.douban.com
 	c.AllowedDomains = []string{"github.com"}
@@ -45,8 +75,12 @@ func (i *cvsInsighter) Insight(_ string) {
 		"language": "go",
 		"stars":    ">500",
 	}
-	c.Visit(i.BaseURL + i.joinMap(m))
+	err := c.Visit(i.BaseURL + i.joinMap(m))
+	if err == nil {
+		err = ctx.Err()
+	}
 
+	return result, err
 }
 
 func (i *cvsInsighter) joinMap(m map[string]string) string {
@@ -5,14 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"sync"
 
 	"github.com/asciimoo/colly"
+	"github.com/deckarep/golang-set"
 	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/media"
 	"github.com/shohi/goinsight/model"
+	"github.com/shohi/goinsight/store"
 	"github.com/shohi/goinsight/util"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -22,25 +26,49 @@ import (
 // TODO: use channel to async and decorate url with `#ID` instead of using global map
 type JSONImageInsighter struct {
 	Config config.JSONImageConfig
+
+	client *http.Client
+	seen   store.SeenStore
 }
 
 // ImageInsighter - fetch images, urls follow below form
 // index page and detail & next page, final image url in detail page
-type ImageInsighter struct{}
+type ImageInsighter struct {
+	Config config.ImageConfig
+}
 
-var logger = zap.NewExample().Sugar()
+var logger = util.NewLogger().Sugar()
 
-// Insight - insight image
-func (i *ImageInsighter) Insight(entryURL string) {
+func init() {
+	Register("json-image", func(v *viper.Viper, seen store.SeenStore) (Insighter, error) {
+		return NewJSONImageInsighter(v, seen)
+	})
+	Register("image", func(v *viper.Viper, _ store.SeenStore) (Insighter, error) {
+		return NewImageInsighter(v)
+	})
+}
+
+// NewImageInsighter -- create new ImageInsighter using configuration
+func NewImageInsighter(v *viper.Viper) (*ImageInsighter, error) {
+	var cfg config.ImageConfig
+	err := v.Unmarshal(&cfg.CommonConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	// Instantiate default collector
-	c := colly.NewCollector()
-	detailCollector := colly.NewCollector()
+	logger.Info(cfg)
+	return &ImageInsighter{cfg}, nil
+}
+
+// Insight - insight image
+func (i *ImageInsighter) Insight(ctx context.Context) (*Result, error) {
+	result := NewResult()
 
-	// Cache responses to prevent multiple download of pages
-	// even if the collector is restarted
-	c.CacheDir = "./_cache"
-	detailCollector.CacheDir = c.CacheDir
+	// Instantiate collectors bound to ctx
+	c := NewCollector(ctx, i.Config.CommonConfig, result)
+	detailCollector := NewCollector(ctx, i.Config.CommonConfig, result)
+	client := NewHTTPClient(ctx, i.Config.CommonConfig, result)
+	downloader := NewDownloader(ctx, i.Config.CommonConfig, client, result)
 
 	// On every a element which has href attribute call callback
 	c.OnHTML("div.content.masonry.on div.mbitem div.mbpic.mbpic2 a", func(e *colly.HTMLElement) {
@@ -51,8 +79,26 @@ func (i *ImageInsighter) Insight(entryURL string) {
 	})
 
 	detailCollector.OnHTML("div.wp #container a[data-id] img[data-original]", func(e *colly.HTMLElement) {
+		if ctx.Err() != nil {
+			return
+		}
+
 		link := e.Attr("data-original")
-		util.Download(link, "", false)
+		result.AddParsed()
+
+		downloader.Enqueue(&Download{
+			URL: link,
+			Dir: i.Config.DownloadDir,
+			Source: media.Source{
+				Page: e.Request.URL.String(),
+				ID:   e.DOM.Closest("a[data-id]").AttrOr("data-id", ""),
+			},
+			Done: func(fp string, n int64, err error) {
+				if err == nil {
+					result.AddNew()
+				}
+			},
+		})
 	})
 
 	// Before making a request print "Visiting ..."
@@ -61,96 +107,145 @@ func (i *ImageInsighter) Insight(entryURL string) {
 	})
 
 	// Start scraping
-	c.Visit(entryURL)
+	err := c.Visit(i.Config.URL)
+	downloader.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return result, err
 }
 
 // Insight - insight image
-func (i *JSONImageInsighter) Insight(ctx context.Context) {
+func (i *JSONImageInsighter) Insight(ctx context.Context) (*Result, error) {
 	defer logger.Sync()
 
-	// Instantiate default collector
-	c := colly.NewCollector()
+	result := NewResult()
 
-	// Cache responses to prevent multiple download of pages
-	// even if the collector is restarted
-	c.CacheDir = "./_cache"
+	// Instantiate collector bound to ctx
+	c := NewCollector(ctx, i.Config.CommonConfig, result)
+	i.client = NewHTTPClient(ctx, i.Config.CommonConfig, result)
+	downloader := NewDownloader(ctx, i.Config.CommonConfig, i.client, result)
+	defer downloader.Wait()
 
 	// Set URLs
-	m := i.getImageURLs(i.Config.URL)
+	m, err := i.getImageURLs(ctx, i.Config.URL)
+	if err != nil {
+		result.AddError(ErrNetwork)
+		return result, err
+	}
+
+	// links queued by this run, which aren't marked until downloaded
+	queued := mapset.NewSet()
 
 	// OnHTML must be set before Visit
 	c.OnHTML("div.wp #container a[data-id] img[data-original]", func(e *colly.HTMLElement) {
-		txn := config.DB.NewTransaction(true)
-		defer txn.Discard()
+		// leave the rest for next run
+		if ctx.Err() != nil {
+			return
+		}
 
 		link := e.Attr("data-original")
+		result.AddParsed()
 
 		// Check whether or not in database
-		item, err := txn.Get([]byte(link))
-		if err == nil {
-			_, e := item.Value()
-			if e == nil {
-				return
-			}
-		}
-
-		logger.Infow("", zap.String("link", link))
-		// fp := i.filepath(link, e.Request.Ctx.Get("ID"))
-		fp := i.filepath(link, "")
-		err = util.Download(link, fp, false)
-		val := "1"
-		if err != nil {
-			logger.Infow("failed to download image",
-				"url", e.Request.URL.String(),
-				"error", err.Error(),
-			)
-			val = "0"
-		}
-
-		err = txn.Set([]byte(link), []byte(val), byte(0))
+		done, err := i.downloaded(link)
 		if err != nil {
+			result.AddError(ErrDB)
 			logger.Info(err.Error())
+			return
+		}
+		if done || !queued.Add(link) {
+			result.AddDuplicate()
+			return
 		}
+
+		logger.Infow("", zap.String("link", link))
+		// dir := i.dir(e.Request.Ctx.Get("ID"))
+		page := e.Request.URL.String()
+		clicks, _ := strconv.Atoi(e.Request.Ctx.Get("Click"))
+		downloader.Enqueue(&Download{
+			URL: link,
+			Dir: i.dir(""),
+			Source: media.Source{
+				Page:   page,
+				ID:     e.Request.Ctx.Get("ID"),
+				Clicks: clicks,
+			},
+			Done: func(fp string, n int64, err error) {
+				// left for next run
+				if ctx.Err() != nil {
+					return
+				}
+
+				meta := store.Meta{Source: page, Status: store.StatusDone}
+				if err != nil {
+					meta.Status = store.StatusFailed
+				} else {
+					result.AddNew()
+				}
+
+				if _, err := i.seen.MarkWithMeta(link, meta); err != nil {
+					result.AddError(ErrDB)
+					logger.Info(err.Error())
+				}
+			},
+		})
 	})
 
 	// Before making a request print "Visiting ..."
 	c.OnRequest(func(r *colly.Request) {
-		r.Ctx.Put("ID", m[r.URL.String()])
+		if info, ok := m[r.URL.String()]; ok {
+			r.Ctx.Put("ID", info.ID)
+			r.Ctx.Put("Click", info.Click)
+		}
 		fmt.Println("Visiting", r.URL.String())
 	})
 
 	// Start scrapping
+	urls := make([]string, 0, len(m))
 	for url := range m {
-		go func(u string) {
-			c.Visit(u)
-		}(url)
+		urls = append(urls, url)
 	}
+	util.ForEachLimit(ctx, urls, i.Config.PageConcurrency(), func(u string) {
+		c.Visit(u)
+	})
 	c.Wait()
+	downloader.Wait()
+
+	return result, ctx.Err()
 }
 
-// NewJSONImageInsighter -- create new JSONImageInsighter using configuration
-func NewJSONImageInsighter(v *viper.Viper) *JSONImageInsighter {
+// NewJSONImageInsighter -- create new JSONImageInsighter using configuration,
+// downloaded images are remembered in seen
+func NewJSONImageInsighter(v *viper.Viper, seen store.SeenStore) (*JSONImageInsighter, error) {
 	var cfg config.JSONImageConfig
+
+	// unmarshal direct fields
 	err := v.Unmarshal(&cfg)
+	if err != nil {
+		return nil, err
+	}
 
+	// unmarshal component
+	err = v.Unmarshal(&cfg.CommonConfig)
 	if err != nil {
-		logger.Info(err)
-		return nil
+		return nil, err
 	}
 
 	logger.Info(cfg)
-	return &JSONImageInsighter{cfg}
+	return &JSONImageInsighter{Config: cfg, seen: seen}, nil
 }
 
-func (i *JSONImageInsighter) getImageURLs(baseURL string) map[string]string {
-	m := make(map[string]string)
+// getImageURLs - gallery pages with enough clicks, by url
+func (i *JSONImageInsighter) getImageURLs(ctx context.Context, baseURL string) (map[string]*model.ImageInfo, error) {
+	m := make(map[string]*model.ImageInfo)
 	u, _ := url.Parse(baseURL)
 	rootURL := u.Scheme + "://" + u.Host
 
 	info, err := i.LoadImageJSON(baseURL)
 	if err != nil {
-		fmt.Println(err)
-		return m
+		return m, err
 	}
 
 	imageList := info.(*model.ImageCollection)
@@ -160,31 +255,33 @@ func (i *JSONImageInsighter) getImageURLs(baseURL string) map[string]string {
 			continue
 		}
 		tURL := rootURL + v.URL
-		m[tURL] = v.ID
+		m[tURL] = v
 	}
 
-	// load other url
-	jsonURLs := util.GetPageURLs(baseURL, imageList.Pages, true)
+	// load other url, page count is in the first json
+	p := NewPaginator(baseURL, i.Config.Pagination, config.PaginationConfig{PageParam: "page"})
+	basePage := util.GetPageParamter(baseURL)
+
+	var jsonURLs []string
+	for _, u := range p.URLs(imageList.Pages) {
+		if util.GetPageParamter(u) != basePage {
+			jsonURLs = append(jsonURLs, u)
+		}
+	}
 	if len(jsonURLs) < 1 {
-		return m
+		return m, nil
 	}
 
 	// use goroutines to load json url
-	var wg sync.WaitGroup
-	wg.Add(len(jsonURLs))
-
-	for _, url := range jsonURLs {
-		go func(u string) {
-			defer wg.Done()
-			i.appendImageURLs(rootURL, u, m)
-		}(url)
-	}
+	var mu sync.Mutex
+	util.ForEachLimit(ctx, jsonURLs, i.Config.PageConcurrency(), func(u string) {
+		i.appendImageURLs(rootURL, u, m, &mu)
+	})
 
-	wg.Wait()
-	return m
+	return m, nil
 }
 
-func (i *JSONImageInsighter) appendImageURLs(rootURL, jsonURL string, m map[string]string) {
+func (i *JSONImageInsighter) appendImageURLs(rootURL, jsonURL string, m map[string]*model.ImageInfo, mu *sync.Mutex) {
 	info, err := i.LoadImageJSON(jsonURL)
 	if err != nil {
 		fmt.Println(err)
@@ -192,6 +289,9 @@ func (i *JSONImageInsighter) appendImageURLs(rootURL, jsonURL string, m map[stri
 	}
 
 	//
+	mu.Lock()
+	defer mu.Unlock()
+
 	imageList := info.(*model.ImageCollection)
 	for _, v := range imageList.List {
 		click, err := strconv.Atoi(v.Click)
@@ -199,25 +299,39 @@ func (i *JSONImageInsighter) appendImageURLs(rootURL, jsonURL string, m map[stri
 			continue
 		}
 		tURL := rootURL + v.URL
-		m[tURL] = v.ID
+		m[tURL] = v
 	}
 
 	return
 }
 
-func (i *JSONImageInsighter) filepath(url, subdir string) (fp string) {
-	filename := util.FilenameFromURL(url)
-	if subdir == "" {
-		fp = filepath.Join(i.Config.DownloadDir, filename)
-	} else {
-		fp = filepath.Join(i.Config.DownloadDir, subdir, filename)
+// downloaded - whether link is seen, and not failed to download so that it is retried
+func (i *JSONImageInsighter) downloaded(link string) (bool, error) {
+	seen, err := i.seen.Has(link)
+	if !seen || err != nil {
+		return false, err
 	}
-	return
+
+	r, err := i.seen.Get(link)
+	if r == nil || err != nil {
+		return false, err
+	}
+	return r.Status != store.StatusFailed, nil
+}
+
+func (i *JSONImageInsighter) dir(subdir string) string {
+	return filepath.Join(i.Config.DownloadDir, subdir)
 }
 
 // LoadImageJSON -- loads image json info
 func (i *JSONImageInsighter) LoadImageJSON(url string) (interface{}, error) {
-	body, err := util.GetContent(url)
+	// client with settings of the section, if it isn't called by Insight
+	client := i.client
+	if client == nil {
+		client = NewHTTPClient(context.Background(), i.Config.CommonConfig, NewResult())
+	}
+
+	body, err := util.GetContentWith(client, url)
 	if err != nil {
 		return nil, err
 	}
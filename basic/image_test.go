@@ -1,8 +1,18 @@
 package basic
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
 )
 
 func TestZapInfo(t *testing.T) {
@@ -11,3 +21,74 @@ func TestZapInfo(t *testing.T) {
 		"time", time.Now(),
 	)
 }
+
+func TestJSONImageRetry(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	broken := true
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/list.json":
+			fmt.Fprint(w, `{"statu":1,"pages":1,"list":[{"id":"1","arcurl":"/g/1.html","click":"9"},{"id":"2","arcurl":"/g/2.html","click":"9"}]}`)
+		case "/g/1.html", "/g/2.html":
+			// both galleries hold a.jpg
+			fmt.Fprintf(w, `<div class="wp"><div id="container">`+
+				`<a data-id="1"><img data-original="%s/img/a.jpg"></a>`+
+				`<a data-id="1"><img data-original="%s/img/b.jpg"></a></div></div>`, ts.URL, ts.URL)
+		case "/img/a.jpg":
+			w.Write([]byte("image a"))
+		case "/img/b.jpg":
+			if broken {
+				http.Error(w, "broken", http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("image b"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.JSONImageConfig{}
+	cfg.URL = ts.URL + "/list.json?page=1"
+	cfg.DownloadDir = dir
+	cfg.Retry.MaxAttempts = 1
+	seen := store.NewMemory()
+
+	run := func() *Result {
+		i := &JSONImageInsighter{Config: cfg, seen: seen}
+		res, err := i.Insight(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// images of both galleries are queued once
+	if res := run(); res.ItemsDuplicate != 2 || hits["/img/a.jpg"] != 1 {
+		t.Errorf("first run has %d duplicates and %d hits of a.jpg, want 2 and 1", res.ItemsDuplicate, hits["/img/a.jpg"])
+	}
+
+	// failed b.jpg is retried by the next run, a.jpg is not
+	mu.Lock()
+	broken = false
+	mu.Unlock()
+	run()
+	if hits["/img/a.jpg"] != 1 || hits["/img/b.jpg"] < 2 {
+		t.Errorf("hits of second run == %v, want b.jpg retried only", hits)
+	}
+	if r, _ := seen.Get(ts.URL + "/img/b.jpg"); r == nil || r.Status != store.StatusDone {
+		t.Errorf("record of retried b.jpg == %+v", r)
+	}
+}
@@ -0,0 +1,67 @@
+package basic
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/sink"
+)
+
+// WriteOutputs - write records, a slice of structs with `csv` tags, in every
+// configured format to `DownloadDir/<prefix><timestamp>.<ext>`, written paths
+// and failures are recorded in res
+func WriteOutputs(cfg config.CommonConfig, prefix string, records interface{}, res *Result) error {
+	t, err := sink.FromStructs(records)
+	if err != nil {
+		res.AddError(ErrOutput)
+		return err
+	}
+
+	return WriteTable(cfg, prefix, t, res)
+}
+
+// WriteTable - same as WriteOutputs but for a prepared table
+func WriteTable(cfg config.CommonConfig, prefix string, t *sink.Table, res *Result) error {
+	base := filepath.Join(cfg.DownloadDir, prefix+time.Now().Format("20060102150405"))
+	logger.Infow("writing outputs", "rows", len(t.Rows), "base", base, "formats", cfg.OutputFormats())
+
+	paths, err := sink.Write(t, base, cfg.OutputFormats())
+	for _, fp := range paths {
+		res.AddOutput(fp)
+	}
+	if err != nil {
+		logger.Infow("output result error", "error", err)
+		res.AddError(ErrOutput)
+	}
+
+	return err
+}
+
+// WriteFailures - write urls failed finally in res to `DownloadDir/failures_<timestamp>.jsonl`,
+// so that they can be retried later
+func WriteFailures(cfg config.CommonConfig, res *Result) error {
+	res.mu.Lock()
+	failures := append([]*Failure{}, res.Failures...)
+	res.mu.Unlock()
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	t, err := sink.FromStructs(failures)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Join(cfg.DownloadDir, "failures_"+time.Now().Format("20060102150405"))
+	paths, err := sink.Write(t, base, []string{"jsonl"})
+	for _, fp := range paths {
+		res.AddOutput(fp)
+	}
+	if err != nil {
+		res.AddError(ErrOutput)
+	}
+
+	return err
+}
@@ -0,0 +1,297 @@
+package basic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/asciimoo/colly"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/util"
+)
+
+// Paginator - discover pages of a listing site, either by reading the page count
+// from the first page and filling it into URL, or by following next links
+type Paginator struct {
+	// URL - template of listing pages, page number fills in the `%d` verb,
+	// or query parameter `PageParam` if there is no verb
+	URL string
+
+	config.PaginationConfig
+
+	// Client - used to fetch the first page, default http.DefaultClient
+	Client *http.Client
+
+	// set once pages beyond MaxPages are left out
+	capped int32
+}
+
+// NewPaginator - create paginator for url template, settings in cfg
+// override the insighter's defaults
+func NewPaginator(urlTemplate string, cfg, defaults config.PaginationConfig) *Paginator {
+	p := &Paginator{URL: urlTemplate, PaginationConfig: defaults}
+
+	if cfg.PageParam != "" {
+		p.PageParam = cfg.PageParam
+	}
+	if cfg.StartPage != 0 {
+		p.StartPage = cfg.StartPage
+	}
+	if cfg.CountSelector != "" {
+		p.CountSelector = cfg.CountSelector
+	}
+	if cfg.CountField != "" {
+		p.CountField = cfg.CountField
+	}
+	if cfg.DefaultPages != 0 {
+		p.DefaultPages = cfg.DefaultPages
+	}
+	if cfg.NextSelector != "" {
+		p.NextSelector = cfg.NextSelector
+	}
+	if cfg.MaxPages != 0 {
+		p.MaxPages = cfg.MaxPages
+	}
+
+	return p
+}
+
+func (p *Paginator) startPage() int {
+	if p.StartPage > 0 {
+		return p.StartPage
+	}
+	return 1
+}
+
+func (p *Paginator) maxPages() int {
+	if p.MaxPages > 0 {
+		return p.MaxPages
+	}
+	return config.DefaultMaxPages
+}
+
+// PageURL - url of n-th page
+func (p *Paginator) PageURL(n int) string {
+	if strings.Contains(p.URL, "%d") {
+		return fmt.Sprintf(p.URL, n)
+	}
+
+	param := p.PageParam
+	if param == "" {
+		param = "page"
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return p.URL
+	}
+
+	// append if absent, so that the rest of query keeps untouched, e.g. `?ajax`
+	q := u.Query()
+	if _, ok := q[param]; !ok {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += url.QueryEscape(param) + "=" + strconv.Itoa(n)
+		return u.String()
+	}
+
+	q.Set(param, strconv.Itoa(n))
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// URLs - urls of `count` pages from the start page, capped by MaxPages
+func (p *Paginator) URLs(count int) []string {
+	if count > p.maxPages() {
+		logger.Infow("page count exceeds cap", "url", p.URL, "count", count, "max_pages", p.maxPages())
+		count = p.maxPages()
+		atomic.StoreInt32(&p.capped, 1)
+	}
+
+	urls := make([]string, 0, count)
+	for k := 0; k < count; k++ {
+		urls = append(urls, p.PageURL(p.startPage()+k))
+	}
+
+	return urls
+}
+
+// Capped - whether pages beyond MaxPages are left out by URLs or Visit,
+// so that not every listing is visited
+func (p *Paginator) Capped() bool {
+	return atomic.LoadInt32(&p.capped) != 0
+}
+
+// Count - read page count from body of the first page
+func (p *Paginator) Count(body []byte) (int, error) {
+	var numStr string
+
+	switch {
+	case p.CountField != "":
+		var v interface{}
+		// json may start with BOM
+		body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+		if err := json.Unmarshal(body, &v); err != nil {
+			return 0, err
+		}
+		for _, key := range strings.Split(p.CountField, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return 0, fmt.Errorf("json field %q not found", p.CountField)
+			}
+			v = m[key]
+		}
+		if f, ok := v.(float64); ok {
+			numStr = strconv.Itoa(int(f))
+		} else {
+			numStr = fmt.Sprint(v)
+		}
+
+	case p.CountSelector != "":
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		numStr = strings.TrimSpace(doc.Find(p.CountSelector).Last().Text())
+
+	default:
+		return 0, errors.New("neither count selector nor count field is set")
+	}
+
+	num, err := strconv.Atoi(numStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page count %q", numStr)
+	}
+
+	// selector points to the last page number instead of the count
+	if p.CountField == "" {
+		num = num - p.startPage() + 1
+	}
+
+	return num, nil
+}
+
+// Pages - fetch the first page and generate urls of all pages.
+// Without count selector and field, DefaultPages pages or the url itself is used.
+func (p *Paginator) Pages(ctx context.Context) ([]string, error) {
+	homePage := p.PageURL(p.startPage())
+
+	// nothing to discover, a fixed number of pages or the url itself
+	if p.CountSelector == "" && p.CountField == "" {
+		if p.DefaultPages > 0 {
+			return p.URLs(p.DefaultPages), nil
+		}
+		if !strings.Contains(p.URL, "%d") {
+			homePage = p.URL
+		}
+		return []string{homePage}, nil
+	}
+
+	logger.Infow("", "home_page", homePage)
+
+	body, err := p.fetch(ctx, homePage)
+	if err != nil {
+		return nil, err
+	}
+
+	num, err := p.Count(body)
+	if err != nil {
+		if p.DefaultPages <= 0 {
+			return nil, err
+		}
+		logger.Infow("page count not found, use default", "error", err, "default_pages", p.DefaultPages)
+		num = p.DefaultPages
+	}
+
+	return p.URLs(num), nil
+}
+
+// Visit - visit all pages with c, at most `limit` pages at the same time.
+// In next link mode, pages are visited one by one by following next links.
+func (p *Paginator) Visit(ctx context.Context, c *colly.Collector, limit int) error {
+	if p.NextSelector == "" {
+		urls, err := p.Pages(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Infow("total pages", "url", p.URL, "count", len(urls))
+
+		util.ForEachLimit(ctx, urls, limit, func(u string) {
+			c.Visit(u)
+		})
+		c.Wait()
+
+		return ctx.Err()
+	}
+
+	var mu sync.Mutex
+	visited := 1
+	c.OnHTML(p.NextSelector, func(e *colly.HTMLElement) {
+		// only the first next link of a page counts
+		if e.Request.Ctx.Get("paginator.next") != "" || ctx.Err() != nil {
+			return
+		}
+		e.Request.Ctx.Put("paginator.next", "1")
+
+		link := e.Attr("href")
+		if link == "" {
+			return
+		}
+
+		mu.Lock()
+		if visited >= p.maxPages() {
+			mu.Unlock()
+			logger.Infow("page count reaches cap", "url", p.URL, "max_pages", p.maxPages())
+			atomic.StoreInt32(&p.capped, 1)
+			return
+		}
+		visited++
+		mu.Unlock()
+
+		c.Visit(e.Request.AbsoluteURL(link))
+	})
+
+	err := c.Visit(p.PageURL(p.startPage()))
+	c.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return err
+}
+
+func (p *Paginator) fetch(ctx context.Context, u string) ([]byte, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d of %s", resp.StatusCode, u)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
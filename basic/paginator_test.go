@@ -0,0 +1,94 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asciimoo/colly"
+	"github.com/shohi/goinsight/config"
+)
+
+func TestPaginatorPageURL(t *testing.T) {
+	cases := []struct {
+		url      string
+		param    string
+		expected string
+	}{
+		{"http://a.com/list/o%d/", "", "http://a.com/list/o3/"},
+		{"http://a.com/board?ajax", "p", "http://a.com/board?ajax&p=3"},
+		{"http://a.com/list?page=1&q=x", "", "http://a.com/list?page=3&q=x"},
+	}
+
+	for _, c := range cases {
+		p := &Paginator{URL: c.url}
+		p.PageParam = c.param
+		if got := p.PageURL(3); got != c.expected {
+			t.Errorf("PageURL(%q) = %q, expect %q", c.url, got, c.expected)
+		}
+	}
+}
+
+func TestPaginatorCount(t *testing.T) {
+	p := NewPaginator("http://a.com/%d", config.PaginationConfig{StartPage: 0},
+		config.PaginationConfig{CountSelector: "ol li a", StartPage: 0})
+	n, err := p.Count([]byte(`<ol><li><a>1</a></li><li><a> 12 </a></li></ol>`))
+	if err != nil || n != 12 {
+		t.Errorf("expect 12 pages, got %d, %v", n, err)
+	}
+
+	p = NewPaginator("http://a.com/%d", config.PaginationConfig{CountField: "data.pages"}, config.PaginationConfig{})
+	n, err = p.Count([]byte(`{"data": {"pages": 7}}`))
+	if err != nil || n != 7 {
+		t.Errorf("expect 7 pages, got %d, %v", n, err)
+	}
+}
+
+func TestPaginatorPagesCap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<span class="last">not a number</span>`)
+	}))
+	defer ts.Close()
+
+	p := NewPaginator(ts.URL+"/pn%d/", config.PaginationConfig{MaxPages: 5},
+		config.PaginationConfig{CountSelector: "span.last", DefaultPages: 100000})
+	urls, err := p.Pages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 5 || urls[4] != ts.URL+"/pn5/" {
+		t.Errorf("expect 5 capped pages, got %v", urls)
+	}
+
+	p.DefaultPages = 0
+	if _, err = p.Pages(context.Background()); err == nil {
+		t.Error("expect error without default pages")
+	}
+}
+
+func TestPaginatorFollowNext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `<html><body><p>%s</p><a class="next" href="/%s0">next</a></body></html>`, page, page)
+	}))
+	defer ts.Close()
+
+	p := NewPaginator(ts.URL+"/1", config.PaginationConfig{},
+		config.PaginationConfig{NextSelector: "a.next", MaxPages: 3})
+
+	c := colly.NewCollector()
+	var pages []string
+	c.OnHTML("p", func(e *colly.HTMLElement) {
+		pages = append(pages, e.Text)
+	})
+
+	if err := p.Visit(context.Background(), c, 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(pages, ",") != "1,10,100" {
+		t.Errorf("unexpected visited pages: %v", pages)
+	}
+}
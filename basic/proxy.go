@@ -0,0 +1,75 @@
+package basic
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/util"
+)
+
+var (
+	proxyPoolsMu sync.Mutex
+	proxyPools   = make(map[string]*util.ProxyPool)
+)
+
+// ProxyPool - pool of proxies set in cfg, nil if no proxy is set.
+// Pools are shared by sections with the same settings and live across runs,
+// so proxies out of rotation stay out until they are rechecked.
+func ProxyPool(cfg config.ProxyConfig) (*util.ProxyPool, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	key := fmt.Sprintf("%#v", cfg)
+
+	proxyPoolsMu.Lock()
+	defer proxyPoolsMu.Unlock()
+
+	if pool, ok := proxyPools[key]; ok {
+		return pool, nil
+	}
+
+	proxies := cfg.URLs
+	if cfg.File != "" {
+		fromFile, err := util.LoadProxyFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(append([]string{}, proxies...), fromFile...)
+	}
+
+	pool, err := util.NewProxyPool(proxies)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxFailures > 0 {
+		pool.MaxFailures = cfg.MaxFailures
+	}
+	if cfg.Recheck > 0 {
+		pool.Recheck = cfg.Recheck
+	}
+	if cfg.CheckURL != "" {
+		if u, err := url.Parse(cfg.CheckURL); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy check url %q", cfg.CheckURL)
+		}
+		pool.CheckURL = cfg.CheckURL
+	}
+	pool.BanStatus = cfg.BanStatus
+	pool.BanPatterns = cfg.BanPatterns
+
+	proxyPools[key] = pool
+	return pool, nil
+}
+
+// errTransport - fail every request, used when transport can't be set up as configured
+type errTransport struct {
+	err error
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t errTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
@@ -0,0 +1,95 @@
+package basic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
+)
+
+// Factory - create an insighter from its configuration section, items seen
+// by the insighter are remembered in seen
+type Factory func(v *viper.Viper, seen store.SeenStore) (Insighter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register - make an insighter factory available by name, it is meant to be
+// called from the `init` function of the package which implements the insighter.
+// Register panics if the name is empty, the factory is nil or the name is taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("basic: Register insighter with empty name")
+	}
+	if factory == nil {
+		panic("basic: Register nil factory for insighter " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("basic: Register called twice for insighter " + name)
+	}
+	registry[name] = factory
+}
+
+// TypeKey - key in a config section naming the insighter type of the section,
+// so that sections can be named freely, e.g. several declarative insighters
+const TypeKey = "Insighter"
+
+// Resolve - get the factory of config section `name`, registered either with
+// the type set by TypeKey in the section or with the section name itself
+func Resolve(name string, v *viper.Viper) (Factory, error) {
+	if v != nil {
+		if t := v.GetString(TypeKey); t != "" {
+			return Lookup(t)
+		}
+	}
+	return Lookup(name)
+}
+
+// Lookup - get the factory registered with given name
+func Lookup(name string) (Factory, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown insighter type %q, known types: [%s]",
+			name, strings.Join(Names(), ", "))
+	}
+	return factory, nil
+}
+
+// Names - sorted names of all registered insighters
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New - create the insighter of config section `name` with seen store, see Resolve
+func New(name string, v *viper.Viper, seen store.SeenStore) (Insighter, error) {
+	factory, err := Resolve(name, v)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, fmt.Errorf("config section [%s] not found", name)
+	}
+
+	return factory(v, seen)
+}
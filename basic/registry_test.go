@@ -0,0 +1,41 @@
+package basic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryNames(t *testing.T) {
+	names := Names()
+
+	for _, want := range []string{"book", "github", "image", "json-image"} {
+		found := false
+		for _, name := range names {
+			if name == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Names() == %v, want to contain %q", names, want)
+		}
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	_, err := Lookup("json-imag")
+	if err == nil {
+		t.Fatal("Lookup(unknown) should return error")
+	}
+
+	if !strings.Contains(err.Error(), "json-image") {
+		t.Errorf("Lookup(unknown) error %q should list known types", err)
+	}
+}
+
+func TestNewMissingSection(t *testing.T) {
+	_, err := New("book", nil, nil)
+	if err == nil {
+		t.Error("New with missing config section should return error")
+	}
+}
@@ -0,0 +1,198 @@
+package basic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of errors counted in Result
+const (
+	ErrNetwork  = "network"  // request failed before getting response
+	ErrStatus   = "status"   // response with unexpected status code
+	ErrCanceled = "canceled" // request refused or aborted due to cancellation
+	ErrRobots   = "robots"   // request refused by robots.txt
+	ErrBanned   = "banned"   // response looks like a ban page
+	ErrParse    = "parse"    // page or item can't be parsed
+	ErrDB       = "db"       // read or write database failed
+	ErrDownload = "download" // resource download failed
+	ErrOutput   = "output"   // result file can't be written
+)
+
+// Result - statistics of one insight run, safe for concurrent use
+type Result struct {
+	mu sync.Mutex
+
+	PagesVisited    int
+	ItemsParsed     int
+	ItemsFiltered   int
+	ItemsNew        int
+	ItemsDuplicate  int
+	BytesDownloaded int64
+
+	// error count by kind
+	Errors map[string]int
+
+	// paths of written result files
+	Outputs []string
+
+	// use of each proxy by url
+	Proxies map[string]*ProxyUsage
+
+	// requests failed finally, to be retried later
+	Failures []*Failure
+
+	// downloads made by Downloader
+	Downloads DownloadStats
+}
+
+// Failure - a request failed after all retries
+type Failure struct {
+	URL   string    `csv:"url"`
+	Kind  string    `csv:"kind"`
+	Error string    `csv:"error"`
+	Time  time.Time `csv:"time"`
+}
+
+// ProxyUsage - requests sent through a proxy in one run
+type ProxyUsage struct {
+	Requests int
+	Failures int
+	// out of rotation after the last request
+	Down bool
+}
+
+// NewResult - create empty result
+func NewResult() *Result {
+	return &Result{
+		Errors:  make(map[string]int),
+		Proxies: make(map[string]*ProxyUsage),
+	}
+}
+
+// AddPage - count a visited page of given size
+func (r *Result) AddPage(size int) {
+	r.mu.Lock()
+	r.PagesVisited++
+	r.BytesDownloaded += int64(size)
+	r.mu.Unlock()
+}
+
+// AddParsed - count a parsed item
+func (r *Result) AddParsed() {
+	r.mu.Lock()
+	r.ItemsParsed++
+	r.mu.Unlock()
+}
+
+// AddFiltered - count an item dropped by filters
+func (r *Result) AddFiltered() {
+	r.mu.Lock()
+	r.ItemsFiltered++
+	r.mu.Unlock()
+}
+
+// AddNew - count an item not seen before
+func (r *Result) AddNew() {
+	r.mu.Lock()
+	r.ItemsNew++
+	r.mu.Unlock()
+}
+
+// AddDuplicate - count an item seen before
+func (r *Result) AddDuplicate() {
+	r.mu.Lock()
+	r.ItemsDuplicate++
+	r.mu.Unlock()
+}
+
+// AddBytes - count downloaded bytes
+func (r *Result) AddBytes(n int64) {
+	r.mu.Lock()
+	r.BytesDownloaded += n
+	r.mu.Unlock()
+}
+
+// AddError - count an error of given kind
+func (r *Result) AddError(kind string) {
+	r.mu.Lock()
+	r.Errors[kind]++
+	r.mu.Unlock()
+}
+
+// AddOutput - record path of a written result file
+func (r *Result) AddOutput(path string) {
+	r.mu.Lock()
+	r.Outputs = append(r.Outputs, path)
+	r.mu.Unlock()
+}
+
+// AddProxyUse - count a request sent through proxy
+func (r *Result) AddProxyUse(proxy string, failed, down bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.Proxies[proxy]
+	if !ok {
+		u = &ProxyUsage{}
+		r.Proxies[proxy] = u
+	}
+	u.Requests++
+	if failed {
+		u.Failures++
+	}
+	u.Down = down
+}
+
+// AddFailure - count an error of given kind and record the failed url
+func (r *Result) AddFailure(url, kind string, err error) {
+	f := &Failure{URL: url, Kind: kind, Time: time.Now()}
+	if err != nil {
+		f.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.Errors[kind]++
+	r.Failures = append(r.Failures, f)
+	r.mu.Unlock()
+}
+
+// SetDownloads - record downloads made by Downloader
+func (r *Result) SetDownloads(s DownloadStats) {
+	r.mu.Lock()
+	r.Downloads = s
+	r.mu.Unlock()
+}
+
+// ErrorCount - total number of errors
+func (r *Result) ErrorCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, v := range r.Errors {
+		n += v
+	}
+	return n
+}
+
+// ErrorsString - errors in `kind=count` form sorted by kind, e.g. `network=2 parse=1`
+func (r *Result) ErrorsString() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kinds := make([]string, 0, len(r.Errors))
+	for kind := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	entries := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		entries = append(entries, fmt.Sprintf("%s=%d", kind, r.Errors[kind]))
+	}
+
+	return strings.Join(entries, " ")
+}
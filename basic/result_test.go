@@ -0,0 +1,36 @@
+package basic
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestResultConcurrent(t *testing.T) {
+	res := NewResult()
+
+	var wg sync.WaitGroup
+	for k := 0; k < 10; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.AddPage(100)
+			res.AddNew()
+			res.AddError(ErrParse)
+		}()
+	}
+	wg.Wait()
+
+	res.AddError(ErrNetwork)
+
+	if res.PagesVisited != 10 || res.BytesDownloaded != 1000 || res.ItemsNew != 10 {
+		t.Errorf("result == %+v, want 10 pages, 1000 bytes, 10 new items", res)
+	}
+
+	if got, want := res.ErrorsString(), "network=1 parse=10"; got != want {
+		t.Errorf("ErrorsString() == %q, want %q", got, want)
+	}
+
+	if res.ErrorCount() != 11 {
+		t.Errorf("ErrorCount() == %d, want 11", res.ErrorCount())
+	}
+}
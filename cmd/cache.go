@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/util"
+)
+
+func init() {
+	register("cache", &command{
+		usage: "cache <ls|clear> [section...]",
+		short: "list or clear response cache of sections",
+		run: func(args []string) int {
+			return dispatch("cache", map[string]func([]string) int{
+				"ls":    cacheList,
+				"clear": cacheClear,
+			}, args)
+		},
+	})
+}
+
+// cacheDirs - cache directories of given sections, all sections if empty
+func cacheDirs(sections []string) (map[string]string, bool) {
+	if len(sections) == 0 {
+		sections = config.Sections()
+	}
+
+	dirs := make(map[string]string)
+	for _, section := range sections {
+		v := config.Sub(section)
+		if v == nil {
+			fmt.Fprintf(stderr, "section [%s] not found\n", section)
+			return nil, false
+		}
+
+		if dir := v.GetString("CacheDir"); dir != "" {
+			dirs[section] = dir
+		}
+	}
+
+	return dirs, true
+}
+
+func cacheList(args []string) int {
+	if !loadConfig() {
+		return 1
+	}
+
+	dirs, ok := cacheDirs(args)
+	if !ok {
+		return 1
+	}
+
+	for _, section := range config.Sections() {
+		dir, ok := dirs[section]
+		if !ok {
+			continue
+		}
+
+		size, err := util.DirSize(dir)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\t%s\t%v\n", section, dir, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\t%s\t%d bytes\n", section, dir, size)
+	}
+
+	return 0
+}
+
+func cacheClear(args []string) int {
+	if !loadConfig() {
+		return 1
+	}
+
+	dirs, ok := cacheDirs(args)
+	if !ok {
+		return 1
+	}
+
+	code := 0
+	for section, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Fprintf(stderr, "[%s] clear %s error: %v\n", section, dir, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintf(stdout, "[%s] cleared %s\n", section, dir)
+	}
+
+	return code
+}
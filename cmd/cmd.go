@@ -0,0 +1,158 @@
+// Package cmd - command line interface of goinsight
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/util"
+)
+
+// command - a subcommand, run returns process exit code
+type command struct {
+	usage string
+	short string
+	run   func(args []string) int
+}
+
+var commands = map[string]*command{}
+
+// stdout/stderr, replaceable in tests
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+var logger = util.NewLogger().Sugar()
+
+// global options
+var (
+	configFile string
+	logLevel   string
+	outputDir  string
+)
+
+func register(name string, c *command) {
+	commands[name] = c
+}
+
+// Execute - parse arguments (without program name), run the subcommand
+// and return process exit code. `run` is the default subcommand.
+func Execute(args []string) int {
+	fs := flag.NewFlagSet("goinsight", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&configFile, "config", "", "config `file`, default config.toml in . or ./config")
+	fs.StringVar(&logLevel, "log-level", "debug", "log `level`, one of debug, info, warn, error")
+	fs.StringVar(&outputDir, "output-dir", "", "root `dir` of downloads, overrides DownloadDir of every section")
+	fs.Usage = func() { usage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if err := util.SetLogLevel(logLevel); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	config.OutputDir = outputDir
+
+	name, rest := "run", fs.Args()
+	if len(rest) > 0 {
+		name, rest = rest[0], rest[1:]
+	}
+
+	c, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		usage(fs)
+		return 2
+	}
+
+	return c.run(rest)
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintln(stderr, "Usage: goinsight [global flags] <command> [args]")
+	fmt.Fprintln(stderr)
+	fmt.Fprintln(stderr, "Commands:")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(stderr, "  %-30s %s\n", commands[name].usage, commands[name].short)
+	}
+
+	fmt.Fprintln(stderr)
+	fmt.Fprintln(stderr, "Global flags:")
+	fs.PrintDefaults()
+}
+
+// signalContext - context cancelled on the first SIGINT/SIGTERM, so that
+// insighters stop issuing requests and save what they have collected.
+// The process exits immediately on the second signal.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			logger.Warnw("signal received, shutting down, send again to exit immediately", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(sigCh)
+			return
+		}
+
+		sig := <-sigCh
+		logger.Errorw("signal received again, exit", "signal", sig.String())
+		os.Exit(130)
+	}()
+
+	return ctx, cancel
+}
+
+// loadConfig - load config file given by global flag
+func loadConfig() bool {
+	if err := config.Load(configFile); err != nil {
+		fmt.Fprintln(stderr, "load config error:", err)
+		return false
+	}
+	return true
+}
+
+// dispatch - run the sub-subcommand in args, e.g. `show` of `config show`
+func dispatch(group string, subs map[string]func(args []string) int, args []string) int {
+	if len(args) > 0 {
+		if f, ok := subs[args[0]]; ok {
+			return f(args[1:])
+		}
+		fmt.Fprintf(stderr, "unknown command %q\n", group+" "+args[0])
+	}
+
+	var names []string
+	for name := range subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(stderr, "Usage: goinsight %s <%s>\n", group, strings.Join(names, "|"))
+	return 2
+}
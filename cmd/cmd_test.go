@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
+)
+
+func execute(args ...string) (int, string) {
+	var out bytes.Buffer
+	stdout, stderr = &out, &out
+
+	code := Execute(args)
+	return code, out.String()
+}
+
+func TestList(t *testing.T) {
+	code, out := execute("list")
+	if code != 0 {
+		t.Fatalf("list exit code == %d, want 0", code)
+	}
+
+	for _, name := range []string{"rent-smth", "rent-tc", "rent-ganji", "tour-mfw", "json-image"} {
+		if !strings.Contains(out, name) {
+			t.Errorf("list output %q should contain %q", out, name)
+		}
+	}
+}
+
+func TestConfigShow(t *testing.T) {
+	code, out := execute("-config", "../config/config_ref.toml", "-output-dir", "out", "config", "show", "rent-tc")
+	if code != 0 {
+		t.Fatalf("config show exit code == %d, output %q", code, out)
+	}
+
+	if !strings.Contains(out, `downloaddir = "out/rent-tc"`) {
+		t.Errorf("config show output %q should contain overridden download dir", out)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	code, out := execute("-config", "../config/config_ref.toml", "config", "validate")
+	if code != 0 {
+		t.Errorf("config validate exit code == %d, output %q", code, out)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _ := execute("unknown"); code != 2 {
+		t.Errorf("unknown command exit code == %d, want 2", code)
+	}
+}
+
+func TestScheduledJobs(t *testing.T) {
+	configFile = "../config/config_ref.toml"
+	if !loadConfig() {
+		t.Fatal("load config failed")
+	}
+
+	jobs, err := scheduledJobs([]string{"rent-smth"}, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Jitter == 0 || jobs[0].MaxRuntime == 0 {
+		t.Errorf("scheduledJobs(rent-smth) == %+v, want one job with jitter and max runtime", jobs)
+	}
+
+	if _, err := scheduledJobs([]string{"rent-tc"}, store.NewMemory()); err == nil {
+		t.Error("scheduledJobs of section without Schedule should return error")
+	}
+}
+
+// blockedInsighter - insighter whose requests all fail
+type blockedInsighter struct{}
+
+func (blockedInsighter) Insight(ctx context.Context) (*basic.Result, error) {
+	res := basic.NewResult()
+	res.AddFailure("http://example.com/", basic.ErrStatus, errors.New("403"))
+	return res, nil
+}
+
+func TestScheduledJobFailed(t *testing.T) {
+	basic.Register("blocked", func(v *viper.Viper, _ store.SeenStore) (basic.Insighter, error) {
+		return blockedInsighter{}, nil
+	})
+	viper.Set("blocked", map[string]interface{}{"url": "", "schedule": "0 8 * * *"})
+
+	var out bytes.Buffer
+	stdout = &out
+	jobs, err := scheduledJobs([]string{"blocked"}, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs[0].Run(context.Background()); err == nil {
+		t.Errorf("run with every request failed should fail, output %q", out.String())
+	}
+}
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := filepath.Join(dir, "config.toml")
+	db := filepath.Join(dir, "db")
+	ioutil.WriteFile(cfg, []byte(fmt.Sprintf("[badger]\nDir = %q\nValueDir = %q\n", db, db)), 0644)
+
+	dump := filepath.Join(dir, "dump.jsonl")
+	ioutil.WriteFile(dump, []byte(`{"key":"rent-tc/a_b","record":{"first_seen":"2018-05-01T00:00:00Z","last_seen":"2018-05-01T00:00:00Z","status":"seen"}}
+{"key":"json-image/c.jpg","record":{"first_seen":"2018-05-01T00:00:00Z","last_seen":"2018-05-01T00:00:00Z","status":"done"}}
+`), 0644)
+
+	if code, out := execute("-config", cfg, "db", "import", dump); code != 0 || !strings.Contains(out, "2 records imported") {
+		t.Fatalf("db import == %d, %q", code, out)
+	}
+	if code, out := execute("-config", cfg, "db", "ls", "rent-tc/"); code != 0 || !strings.HasPrefix(out, "rent-tc/a_b\t2018-05-01") {
+		t.Errorf("db ls == %d, %q", code, out)
+	}
+	if code, out := execute("-config", cfg, "db", "stats"); code != 0 || !strings.Contains(out, "json-image\t1 keys") {
+		t.Errorf("db stats == %d, %q", code, out)
+	}
+
+	if code, _ := execute("-config", cfg, "db", "purge"); code != 2 {
+		t.Errorf("db purge without flags == %d, want 2", code)
+	}
+	if code, out := execute("-config", cfg, "db", "purge", "-prefix", "rent-tc/", "-older-than", "24h"); code != 0 || !strings.Contains(out, "1 keys purged") {
+		t.Errorf("db purge == %d, %q", code, out)
+	}
+
+	exported := filepath.Join(dir, "exported.jsonl")
+	if code, out := execute("-config", cfg, "db", "export", "-format", "jsonl", exported); code != 0 {
+		t.Fatalf("db export == %d, %q", code, out)
+	}
+	data, _ := ioutil.ReadFile(exported)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"key":"json-image/c.jpg"`) {
+		t.Errorf("exported: %s", data)
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/schedule"
+	"github.com/shohi/goinsight/sink"
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	register("config", &command{
+		usage: "config <validate|show>",
+		short: "validate config file or show a section of it",
+		run: func(args []string) int {
+			return dispatch("config", map[string]func([]string) int{
+				"validate": validateConfig,
+				"show":     showConfig,
+			}, args)
+		},
+	})
+}
+
+// validateConfig - check that base type is registered and every section
+// of a registered insighter can be used to create it
+func validateConfig(args []string) int {
+	if !loadConfig() {
+		return 1
+	}
+
+	failed := false
+	report := func(format string, a ...interface{}) {
+		failed = true
+		fmt.Fprintf(stdout, format+"\n", a...)
+	}
+
+	if len(config.BaseConfig.Type) == 0 {
+		report("[base] Type is empty")
+	}
+	for _, t := range config.BaseConfig.Type {
+		if _, err := basic.Resolve(t, config.Sub(t)); err != nil {
+			report("[base] %v", err)
+		}
+	}
+
+	if config.BadgerConfig.Dir == "" || config.BadgerConfig.ValueDir == "" {
+		report("[badger] Dir and ValueDir should not be empty")
+	}
+
+	for _, section := range config.Sections() {
+		if _, err := basic.Resolve(section, config.Sub(section)); err != nil {
+			fmt.Fprintf(stdout, "[%s] skipped, no insighter registered\n", section)
+			continue
+		}
+
+		if _, err := basic.New(section, config.Sub(section), store.NewMemory()); err != nil {
+			report("[%s] %v", section, err)
+			continue
+		}
+
+		var cfg config.CommonConfig
+		if err := config.Sub(section).Unmarshal(&cfg); err == nil {
+			if _, err := basic.ProxyPool(cfg.Proxy); err != nil {
+				report("[%s] proxy: %v", section, err)
+			}
+			if _, err := basic.CookieJar(cfg); err != nil {
+				report("[%s] cookie: %v", section, err)
+			}
+			if err := basic.DedupeOptions(cfg).Check(); err != nil {
+				report("[%s] %v", section, err)
+			}
+		}
+
+		if outputs := config.Sub(section).GetStringSlice("Outputs"); len(outputs) > 0 {
+			if err := sink.Check(outputs); err != nil {
+				report("[%s] %v", section, err)
+			}
+		}
+
+		if spec := config.Sub(section).GetString("Schedule"); spec != "" {
+			if _, err := schedule.Parse(spec); err != nil {
+				report("[%s] %v", section, err)
+			}
+		}
+	}
+
+	if failed {
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "config is valid")
+	return 0
+}
+
+// showConfig - print settings of given section in `key = value` form
+func showConfig(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "Usage: goinsight config show <section>")
+		return 2
+	}
+
+	if !loadConfig() {
+		return 1
+	}
+
+	section := args[0]
+	var v *viper.Viper
+	if section == "base" || section == "badger" {
+		v = viper.Sub(section)
+	} else {
+		v = config.Sub(section)
+	}
+
+	if v == nil {
+		fmt.Fprintf(stderr, "section [%s] not found\n", section)
+		return 1
+	}
+
+	keys := v.AllKeys()
+	sort.Strings(keys)
+
+	fmt.Fprintf(stdout, "[%s]\n", section)
+	for _, key := range keys {
+		fmt.Fprintf(stdout, "%s = %#v\n", key, v.Get(key))
+	}
+
+	return 0
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
+	"github.com/shohi/goinsight/util"
+)
+
+func init() {
+	register("db", &command{
+		usage: "db <info|stats|get|ls|export|import|purge|gc|reset>",
+		short: "inspect, export, purge or reset the badger store",
+		run: func(args []string) int {
+			return dispatch("db", map[string]func([]string) int{
+				"info":   dbInfo,
+				"stats":  dbStats,
+				"get":    dbGet,
+				"ls":     dbList,
+				"export": dbExport,
+				"import": dbImport,
+				"purge":  dbPurge,
+				"gc":     dbGC,
+				"reset":  dbReset,
+			}, args)
+		},
+	})
+}
+
+// dbInfo - print location and size of badger files
+func dbInfo(args []string) int {
+	if !loadConfig() {
+		return 1
+	}
+
+	dirs := []string{config.BadgerConfig.Dir}
+	if config.BadgerConfig.ValueDir != config.BadgerConfig.Dir {
+		dirs = append(dirs, config.BadgerConfig.ValueDir)
+	}
+
+	for _, dir := range dirs {
+		size, err := util.DirSize(dir)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\t%v\n", dir, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\t%d bytes\n", dir, size)
+	}
+
+	return 0
+}
+
+// openStore - open badger store set in [badger], wiped first if NewDB is set.
+// It should be closed once insighters are done.
+func openStore() (*store.Badger, error) {
+	if config.BadgerConfig.NewDB {
+		if err := config.RemoveDB(); err != nil {
+			return nil, err
+		}
+	}
+	return store.OpenBadger(config.BadgerConfig.Dir, config.BadgerConfig.ValueDir)
+}
+
+// dbReset - remove all badger files, which forgets every seen item
+func dbReset(args []string) int {
+	if !loadConfig() {
+		return 1
+	}
+
+	if err := config.RemoveDB(); err != nil {
+		fmt.Fprintln(stderr, "reset db error:", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "db removed:", config.BadgerConfig.Dir)
+	return 0
+}
+
+// openDB - open badger store set in [badger] for maintenance, kept as it is even if NewDB is set
+func openDB() (*store.Badger, bool) {
+	if !loadConfig() {
+		return nil, false
+	}
+
+	b, err := store.OpenBadger(config.BadgerConfig.Dir, config.BadgerConfig.ValueDir)
+	if err != nil {
+		fmt.Fprintln(stderr, "open db error:", err)
+		return nil, false
+	}
+	return b, true
+}
+
+// dbFlags - flag set of db subcommand name
+func dbFlags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("db "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: goinsight db %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// dbStats - print number and size of keys of each namespace, i.e. section
+func dbStats(args []string) int {
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	stats, err := b.Stats()
+	if err != nil {
+		fmt.Fprintln(stderr, "stats error:", err)
+		return 1
+	}
+
+	var keys, size int64
+	for _, s := range stats {
+		ns := s.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		fmt.Fprintf(stdout, "%s\t%d keys\t%d bytes\n", ns, s.Keys, s.Bytes)
+		keys, size = keys+s.Keys, size+s.Bytes
+	}
+	fmt.Fprintf(stdout, "total\t%d keys\t%d bytes\n", keys, size)
+
+	return 0
+}
+
+// dbGet - print records of keys as json
+func dbGet(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "Usage: goinsight db get <key...>")
+		return 2
+	}
+
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	code := 0
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	for _, key := range args {
+		r, err := b.Get(key)
+		if err != nil || r == nil {
+			fmt.Fprintf(stderr, "%s: not found %v\n", key, err)
+			code = 1
+			continue
+		}
+		enc.Encode(store.Entry{Key: key, Record: r})
+	}
+
+	return code
+}
+
+// dbList - print keys with prefix, e.g. `rent-tc/`, with when and where they were last seen
+func dbList(args []string) int {
+	prefix := ""
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	err := b.Scan(prefix, func(key string, r *store.Record) error {
+		_, err := fmt.Fprintf(stdout, "%s\t%s\t%s\t%s\n", key, r.LastSeen.Format(time.RFC3339), r.Status, r.Source)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, "list error:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// dbExport - write every record, one json entry per line, to file or stdout
+func dbExport(args []string) int {
+	fs := dbFlags("export", "[flags] [file]")
+	format := fs.String("format", "jsonl", "`format` of records, only jsonl")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "jsonl" {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return 2
+	}
+
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	w := stdout
+	if fp := fs.Arg(0); fp != "" && fp != "-" {
+		file, err := os.Create(fp)
+		if err != nil {
+			fmt.Fprintln(stderr, "export error:", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	err := b.Scan("", func(key string, r *store.Record) error {
+		n++
+		return enc.Encode(store.Entry{Key: key, Record: r})
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "export error:", err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "%d records exported\n", n)
+	return 0
+}
+
+// dbImport - write records exported by dbExport, from file or stdin
+func dbImport(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "Usage: goinsight db import <file|->")
+		return 2
+	}
+
+	r := os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(stderr, "import error:", err)
+			return 1
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var entries []store.Entry
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e store.Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && (e.Key == "" || e.Record == nil) {
+			err = errors.New("key or record missing")
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "import error: entry %d: %v\n", len(entries)+1, err)
+			return 1
+		}
+		entries = append(entries, e)
+	}
+
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	if err := b.Put(entries); err != nil {
+		fmt.Fprintln(stderr, "import error:", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%d records imported\n", len(entries))
+	return 0
+}
+
+// dbPurge - forget keys with prefix and last seen long ago, so that they are new again
+func dbPurge(args []string) int {
+	fs := dbFlags("purge", "[flags]")
+	prefix := fs.String("prefix", "", "purge keys with `prefix`, e.g. rent-tc/")
+	olderThan := fs.Duration("older-than", 0, "purge keys not seen for `duration`, e.g. 720h")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *prefix == "" && *olderThan == 0 {
+		fmt.Fprintln(stderr, "prefix or older-than must be given, `db reset` removes everything")
+		return 2
+	}
+
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	var before time.Time
+	if *olderThan > 0 {
+		before = time.Now().Add(-*olderThan)
+	}
+
+	n, err := b.Purge(*prefix, before)
+	fmt.Fprintf(stdout, "%d keys purged\n", n)
+	if err != nil {
+		fmt.Fprintln(stderr, "purge error:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// dbGC - reclaim space of purged and replaced records
+func dbGC(args []string) int {
+	fs := dbFlags("gc", "[flags]")
+	ratio := fs.Float64("discard-ratio", 0.5, "rewrite value log files of which at least `ratio` can be discarded")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	b, ok := openDB()
+	if !ok {
+		return 1
+	}
+	defer b.Close()
+
+	n, err := b.GC(*ratio)
+	if err != nil {
+		fmt.Fprintln(stderr, "gc error:", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%d value log files rewritten\n", n)
+	return 0
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shohi/goinsight/basic"
+)
+
+func init() {
+	register("list", &command{
+		usage: "list",
+		short: "list registered insighter types",
+		run:   listInsighters,
+	})
+}
+
+func listInsighters(args []string) int {
+	for _, name := range basic.Names() {
+		fmt.Fprintln(stdout, name)
+	}
+	return 0
+}
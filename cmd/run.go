@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/router"
+	"github.com/shohi/goinsight/util"
+)
+
+func init() {
+	register("run", &command{
+		usage: "run [type...]",
+		short: "run insighters of given types concurrently, default Type in [base]",
+		run:   runInsight,
+	})
+}
+
+func runInsight(args []string) int {
+	defer util.LogProcessTime(logger.Desugar(), time.Now())
+
+	if !loadConfig() {
+		return 1
+	}
+
+	types := config.BaseConfig.Type
+	if len(args) > 0 {
+		types = args
+	}
+
+	if len(types) == 0 {
+		fmt.Fprintln(stderr, "no insighter type given")
+		return 2
+	}
+
+	for _, t := range types {
+		if _, err := basic.Resolve(t, config.Sub(t)); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	seen, err := openStore()
+	if err != nil {
+		fmt.Fprintln(stderr, "open db error:", err)
+		return 1
+	}
+	defer seen.Close()
+
+	ctx, doCancelFunc := signalContext()
+	defer doCancelFunc()
+
+	reports := router.Route(ctx, types, seen)
+	router.PrintSummary(stdout, reports)
+
+	// interrupted, results collected so far have been saved
+	if ctx.Err() != nil {
+		return 130
+	}
+
+	if router.Failed(reports) {
+		return 1
+	}
+
+	return 0
+}
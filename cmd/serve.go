@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/router"
+	"github.com/shohi/goinsight/schedule"
+	"github.com/shohi/goinsight/store"
+)
+
+func init() {
+	register("serve", &command{
+		usage: "serve [type...]",
+		short: "run insighters on the Schedule of their sections, default all scheduled sections",
+		run:   serve,
+	})
+}
+
+func serve(args []string) int {
+	if !loadConfig() {
+		return 1
+	}
+
+	types := args
+	if len(types) == 0 {
+		for _, section := range config.Sections() {
+			if _, err := basic.Resolve(section, config.Sub(section)); err != nil {
+				continue
+			}
+			if config.Sub(section).GetString("Schedule") != "" {
+				types = append(types, section)
+			}
+		}
+	}
+
+	if len(types) == 0 {
+		fmt.Fprintln(stderr, "no scheduled section found, set Schedule in sections to serve")
+		return 1
+	}
+
+	seen, err := openStore()
+	if err != nil {
+		fmt.Fprintln(stderr, "open db error:", err)
+		return 1
+	}
+	defer seen.Close()
+
+	jobs, err := scheduledJobs(types, seen)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	ctx, doCancelFunc := signalContext()
+	defer doCancelFunc()
+
+	schedule.Run(ctx, jobs)
+
+	return 0
+}
+
+// scheduledJobs - build one job for each type from its config section,
+// runs of all jobs share seen
+func scheduledJobs(types []string, seen store.SeenStore) ([]*schedule.Job, error) {
+	var jobs []*schedule.Job
+
+	for _, t := range types {
+		if _, err := basic.Resolve(t, config.Sub(t)); err != nil {
+			return nil, err
+		}
+
+		v := config.Sub(t)
+		if v == nil {
+			return nil, fmt.Errorf("config section [%s] not found", t)
+		}
+
+		var cfg config.CommonConfig
+		if err := v.Unmarshal(&cfg); err != nil {
+			return nil, fmt.Errorf("[%s] %v", t, err)
+		}
+
+		if cfg.Schedule == "" {
+			return nil, fmt.Errorf("[%s] Schedule is not set", t)
+		}
+
+		spec, err := schedule.Parse(cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", t, err)
+		}
+
+		name := t
+		jobs = append(jobs, &schedule.Job{
+			Name:       name,
+			Schedule:   spec,
+			Jitter:     cfg.Jitter,
+			MaxRuntime: cfg.MaxRuntime,
+			Run: func(ctx context.Context) error {
+				reports := router.Route(ctx, []string{name}, seen)
+				router.PrintSummary(stdout, reports)
+				return reports[0].Failure()
+			},
+		})
+	}
+
+	return jobs, nil
+}
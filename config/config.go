@@ -2,18 +2,19 @@
 package config
 
 import (
-	"context"
 	"os"
+	"path/filepath"
+	"sort"
+	"time"
 
-	"github.com/dgraph-io/badger"
 	"github.com/shohi/goinsight/util"
 	"github.com/spf13/viper"
-	"go.uber.org/zap"
 )
 
 type baseConfig struct {
-	// search type
-	Type string
+	// search types, either a single type or a list of types,
+	// filled by Load since mapstructure can't lift a string into a slice
+	Type []string `mapstructure:"-"`
 }
 
 type badgerConfig struct {
@@ -33,6 +34,202 @@ type CommonConfig struct {
 
 	CacheDir string
 	NewCache bool
+
+	// downloads larger than MaxDownloadSize bytes are dropped, zero means no limit
+	MaxDownloadSize int64
+	// record SHA-256 of each download in `<file>.sha256`
+	Checksum bool
+	// downloads are queued and made by DownloadWorkers workers, default 4,
+	// at most DownloadPerHost at a time from the same host, default 2.
+	// Crawling waits once DownloadQueue downloads are queued, default 64.
+	DownloadWorkers int
+	DownloadPerHost int
+	DownloadQueue   int
+	// dedupe of downloaded images, set in a `[<section>.Dedupe]` table
+	Dedupe DedupeConfig
+	// processing of downloaded images, set in a `[<section>.PostProcess]` table
+	PostProcess PostProcessConfig
+
+	// max number of pages fetched at the same time, default DefaultConcurrency
+	Concurrency int
+
+	// politeness of requests to domains not matching any of Limits, which share
+	// it as a whole rather than each getting its own: fixed delay after each
+	// request, random delay before each request and max number of requests in flight
+	Delay       time.Duration
+	RandomDelay time.Duration
+	Parallelism int
+	// per-domain politeness, set in `[[<section>.Limits]]` tables
+	Limits []LimitConfig
+	// honor robots.txt of visited hosts
+	RespectRobotsTxt bool
+
+	// proxies requests are rotated through, set in a `[<section>.Proxy]` table
+	Proxy ProxyConfig
+
+	// headers set on every request, set in a `[<section>.Headers]` table
+	Headers map[string]string
+	// user agents requests are rotated through, colly's default if empty
+	UserAgents []string
+	// cookies sent with every request, e.g. "name1=value1; name2=value2"
+	Cookie string
+	// Netscape cookies.txt file, e.g. exported from a browser, loaded into the cookie jar
+	CookieFile string
+	// file the cookie jar is saved to and loaded from, so that sessions are kept
+	// between runs, in Netscape cookies.txt format. Cookies are kept in memory if empty.
+	CookieJar string
+
+	// retry of failed requests, set in a `[<section>.Retry]` table
+	Retry RetryConfig
+
+	// discovery of listing pages, set in a `[<section>.Pagination]` table,
+	// settings left empty fall back to the insighter's own
+	Pagination PaginationConfig
+
+	// formats of collected records, a list of csv, xlsx, jsonl and stdout, default DefaultOutputs
+	Outputs []string
+
+	// when items seen by earlier runs are collected again, set in a `[<section>.Seen]` table
+	Seen SeenConfig
+
+	// cron expression used by `serve`, e.g. "*/30 8-22 * * *" or "@every 2h"
+	Schedule string
+	// random delay added to each scheduled run, e.g. "5m"
+	Jitter time.Duration
+	// scheduled run is cancelled after MaxRuntime, zero means no limit
+	MaxRuntime time.Duration
+}
+
+// DefaultConcurrency - default max number of pages fetched at the same time by an insighter
+const DefaultConcurrency = 8
+
+// PageConcurrency - max number of pages fetched at the same time
+func (c CommonConfig) PageConcurrency() int {
+	if c.Concurrency > 0 {
+		return c.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// LimitConfig - politeness for domains matching DomainGlob, e.g. "*.58.com"
+type LimitConfig struct {
+	DomainGlob  string
+	Delay       time.Duration
+	RandomDelay time.Duration
+	// max number of requests in flight, default 1
+	Parallelism int
+}
+
+// ProxyConfig - proxies requests of a section are rotated through,
+// requests go direct if neither URLs nor File is set
+type ProxyConfig struct {
+	// proxy urls, e.g. "http://127.0.0.1:8080" or "socks5://127.0.0.1:1080"
+	URLs []string
+	// file of proxy urls, one per line
+	File string
+
+	// consecutive failures before a proxy is taken out of rotation, default 3
+	MaxFailures int
+	// a proxy out of rotation is tried again after Recheck, default "5m"
+	Recheck time.Duration
+	// url requested through proxies out of rotation every Recheck in the background,
+	// those answering are put back. If not set, a proxy out of rotation is put back
+	// for a trial request once Recheck is due.
+	CheckURL string
+
+	// responses taken as ban pages, which count as failures of the proxy,
+	// by status code, or text in redirect location or html body
+	BanStatus   []int
+	BanPatterns []string
+}
+
+// Enabled - whether any proxy is set
+func (c ProxyConfig) Enabled() bool {
+	return len(c.URLs) > 0 || c.File != ""
+}
+
+// DedupeConfig - dedupe of images under DownloadDir by content and perceptual hash,
+// reported in `dedupe_report.json` under DownloadDir
+type DedupeConfig struct {
+	Enabled bool
+	// what is done to a download identical to an existing image, "link" (default)
+	// replaces it with a hard link to the image, "skip" removes it and "none" keeps it
+	Action string
+	// images at least this similar by perceptual hash, in [0, 1], are reported
+	// as near-duplicates, default 0.9
+	Similarity float64
+}
+
+// PostProcessConfig - processing of downloaded images, each directory of
+// processed images gets a `manifest.json` listing them with dimensions, EXIF
+// and the page, gallery or note they come from
+type PostProcessConfig struct {
+	Enabled bool
+	// images narrower, lower or smaller in bytes are removed, zero means no limit
+	MinWidth  int
+	MinHeight int
+	MinBytes  int64
+	// max side of thumbnails written to `.thumbs` next to images, zero means none
+	Thumbnail int
+}
+
+// SeenConfig - when an item seen by an earlier run is taken as new again,
+// it never is by default. Items new again are marked in the `status` column.
+type SeenConfig struct {
+	// item not seen for longer than TTL, e.g. a listing reposted after weeks, "336h"
+	TTL time.Duration
+	// item whose content changed, e.g. rental of a listing
+	Resurface bool
+}
+
+// RetryConfig - retry of requests failing with network errors or retryable
+// status codes, settings left empty fall back to util.DefaultRetryPolicy
+type RetryConfig struct {
+	// max number of attempts including the first one, 1 means no retry
+	MaxAttempts int
+	// wait before the first retry, doubled after each retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// wait is randomized by ±Jitter of itself, e.g. 0.2
+	Jitter float64
+	// e.g. [429, 500, 502, 503, 504]
+	RetryStatus []int
+}
+
+// PaginationConfig - how pages of a listing site are discovered
+type PaginationConfig struct {
+	// name of query parameter holding page number, used if URL has no `%d` verb
+	PageParam string
+	// number of the first page, default 1
+	StartPage int
+
+	// selector of element whose text is the last page number
+	CountSelector string
+	// dot separated path of json field holding the page count, e.g. "data.pages"
+	CountField string
+	// page count used if it can't be found on the first page, zero means failing instead
+	DefaultPages int
+
+	// selector of the link to next page, enables following next links
+	// instead of counting pages
+	NextSelector string
+
+	// hard cap on the number of pages, default DefaultMaxPages
+	MaxPages int
+}
+
+// DefaultMaxPages - default hard cap on the number of pages of a listing
+const DefaultMaxPages = 100
+
+// DefaultOutputs - default formats of collected records
+var DefaultOutputs = []string{"xlsx"}
+
+// OutputFormats - formats of collected records
+func (c CommonConfig) OutputFormats() []string {
+	if len(c.Outputs) > 0 {
+		return c.Outputs
+	}
+	return DefaultOutputs
 }
 
 // BookConfig - configuration for book info scrapping
@@ -61,6 +258,11 @@ type SmthRentConfig struct {
 	CommonConfig
 	BannedAuthors string
 	BannedTitles  string
+
+	// nForum account, boards are visited anonymously if User is empty.
+	// Overridden by env GOINSIGHT_SMTH_USER and GOINSIGHT_SMTH_PASSWORD if set.
+	User     string
+	Password string
 }
 
 // TcRentConfig - configuration for fetching rent information from `58同城`
@@ -81,6 +283,62 @@ type GanjiRentConfig struct {
 	DefaultTotalPages int
 }
 
+// DeclarativeConfig - configuration of an insighter whose items are declared
+// by css selectors, see `Insighter = "declarative"` sections in config_ref.toml
+type DeclarativeConfig struct {
+	CommonConfig
+
+	// selector of each item on listing pages
+	ItemSelector string
+	// fields of an item, also the output columns in order
+	Fields []FieldConfig
+	// names of fields joined as the key to tell seen items, default all fields
+	KeyFields []string
+	// items not passing all filters are dropped
+	Filters []FilterConfig
+	// prefix of output files, default "items_"
+	OutputPrefix string
+}
+
+// FieldConfig - how a field is extracted from an item
+type FieldConfig struct {
+	Name string
+	// selector relative to the item, the first match is used, empty means the item itself
+	Selector string
+	// attribute to read, empty means the text
+	Attr string
+	// regexp applied to the value, the first group is used if any, otherwise the whole match
+	Regexp string
+	// one of string, int, float, time, unix, unixms and url, default string
+	Type string
+	// layout of time type, empty means guessing by common layouts
+	Layout string
+	// item is dropped if the field is empty or fails to convert
+	Required bool
+}
+
+// FilterConfig - condition on a field an item has to meet
+type FilterConfig struct {
+	Field string
+
+	// value has to be one of In
+	In []string
+	// value must not be any of NotIn
+	NotIn []string
+	// value must not contain any of NotContains
+	NotContains []string
+
+	// bounds of int and float fields, ignored if nil
+	Min *float64
+	Max *float64
+
+	// time fields must not be older than MaxAge, e.g. "360h"
+	MaxAge time.Duration
+
+	// value must not repeat in a run, e.g. one post per author
+	Unique bool
+}
+
 var (
 	// BaseConfig - config type
 	BaseConfig baseConfig
@@ -88,35 +346,52 @@ var (
 	// BadgerConfig - config of badger
 	BadgerConfig badgerConfig
 
-	// DB - badger DB
-	DB *badger.DB
+	// OutputDir - root of download directories, overrides
+	// `DownloadDir` of every section if not empty
+	OutputDir string
 )
 
-var logger = zap.NewExample().Sugar()
+var logger = util.NewLogger().Sugar()
+
+// reserved sections which don't configure any insighter
+var reservedSections = map[string]bool{
+	"base":   true,
+	"badger": true,
+}
 
-// Init - load configs from file
-func Init(ctx context.Context) {
-	err := loadTOML()
+// Load - load configs from given file, search `config.toml` in `.` and
+// `./config` if file is empty
+func Load(file string) error {
+	err := loadTOML(file)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	//
-	baseCfg := viper.Sub("base")
-	baseCfg.Unmarshal(&BaseConfig)
-
-	badgerConfig := viper.Sub("badger")
-	badgerConfig.Unmarshal(&BadgerConfig)
+	if baseCfg := viper.Sub("base"); baseCfg != nil {
+		if err = baseCfg.Unmarshal(&BaseConfig); err != nil {
+			return err
+		}
+		BaseConfig.Type = baseCfg.GetStringSlice("Type")
+	}
 
-	//
-	initDB(ctx)
+	if badgerCfg := viper.Sub("badger"); badgerCfg != nil {
+		if err = badgerCfg.Unmarshal(&BadgerConfig); err != nil {
+			return err
+		}
+	}
 
+	return nil
 }
 
-func loadTOML() error {
-	viper.SetConfigName("config") // name of config file (without extension)
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./config")
+func loadTOML(file string) error {
+	if file != "" {
+		viper.SetConfigFile(file)
+	} else {
+		viper.SetConfigName("config") // name of config file (without extension)
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("./config")
+	}
 	err := viper.ReadInConfig()
 	if err != nil {
 		return err
@@ -124,43 +399,34 @@ func loadTOML() error {
 	return nil
 }
 
-// InitDB - init badger
-func initDB(ctx context.Context) {
-	// Open the Badger database located in the /tmp/badger directory.
-	// It will be created if it doesn't exist.
-
-	opts := badger.DefaultOptions
-	opts.Dir = BadgerConfig.Dir
-	opts.ValueDir = BadgerConfig.ValueDir
-
-	newDB := BadgerConfig.NewDB
-
-	if newDB {
-		os.RemoveAll(opts.Dir)
-		os.RemoveAll(opts.ValueDir)
+// Sub - get config section of given name, nil if not exists.
+// DownloadDir is redirected to `OutputDir/name` when OutputDir is set.
+func Sub(name string) *viper.Viper {
+	v := viper.Sub(name)
+	if v != nil && OutputDir != "" {
+		v.Set("DownloadDir", filepath.Join(OutputDir, name))
 	}
+	return v
+}
 
-	if exists, err := util.Exists(opts.Dir); !exists || (err != nil) {
-		err = os.MkdirAll(opts.Dir, os.ModePerm)
-		if err != nil {
-			logger.Fatal(err)
-			panic("Init DB Error")
+// Sections - sorted names of all sections which configure an insighter
+func Sections() []string {
+	var sections []string
+	for key, val := range viper.AllSettings() {
+		if _, ok := val.(map[string]interface{}); !ok || reservedSections[key] {
+			continue
 		}
+		sections = append(sections, key)
 	}
+	sort.Strings(sections)
 
-	db, err := badger.Open(opts)
-	if err != nil {
-		logger.Fatal(err)
-	}
-
-	// close db when context is done
-	go func() {
-		select {
-		case <-ctx.Done():
-			logger.Info("DB to be closed")
-			db.Close()
-		}
-	}()
+	return sections
+}
 
-	DB = db
+// RemoveDB - remove all badger files
+func RemoveDB() error {
+	if err := os.RemoveAll(BadgerConfig.Dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(BadgerConfig.ValueDir)
 }
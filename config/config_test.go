@@ -1,34 +1,64 @@
 package config
 
 import (
-	"context"
 	"log"
 	"testing"
-	"time"
 
 	"github.com/spf13/viper"
 )
 
 func TestLoadTOML(t *testing.T) {
-	ctx, doCancelFunc := context.WithCancel(context.Background())
-	defer func() {
-		doCancelFunc()
-		time.Sleep(time.Second)
-	}()
-	Init(ctx)
+	err := Load("config_ref.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
 	log.Println(BaseConfig)
 	log.Println(BadgerConfig)
 
+	if len(BaseConfig.Type) != 1 || BaseConfig.Type[0] != "json-image" {
+		t.Errorf("BaseConfig.Type == %v, want [json-image]", BaseConfig.Type)
+	}
+
 	// unmarshal direct fields
 	var cfg SmthRentConfig
 	vs := viper.Sub("rent-smth")
 	vs.Unmarshal(&cfg)
 
 	// unmarshal component
-	err := vs.Unmarshal(&cfg.CommonConfig)
+	err = vs.Unmarshal(&cfg.CommonConfig)
 
 	if err != nil {
 		log.Println(err)
 	}
 	log.Println(cfg)
 }
+
+func TestSub(t *testing.T) {
+	if err := Load("config_ref.toml"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { OutputDir = "" }()
+	OutputDir = "out"
+
+	got := Sub("rent-smth").GetString("DownloadDir")
+	if want := "out/rent-smth"; got != want {
+		t.Errorf("Sub(%q) DownloadDir == %v, want %v", "rent-smth", got, want)
+	}
+
+	if Sub("not-exist") != nil {
+		t.Errorf("Sub(%q) should be nil", "not-exist")
+	}
+}
+
+func TestSections(t *testing.T) {
+	if err := Load("config_ref.toml"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, section := range Sections() {
+		if section == "base" || section == "badger" {
+			t.Errorf("Sections() should not contain reserved section %q", section)
+		}
+	}
+}
@@ -1,26 +1,11 @@
 package main
 
 import (
-	"context"
-	"time"
+	"os"
 
-	"github.com/shohi/goinsight/config"
-	"github.com/shohi/goinsight/router"
-	"github.com/shohi/goinsight/util"
-	"go.uber.org/zap"
+	"github.com/shohi/goinsight/cmd"
 )
 
-var logger = zap.NewExample()
-
 func main() {
-	defer util.LogProcessTime(logger, time.Now())
-
-	ctx, doCancelFunc := context.WithCancel(context.Background())
-	defer doCancelFunc()
-
-	// load config
-	config.Init(ctx)
-
-	// route
-	router.Route(ctx)
+	os.Exit(cmd.Execute(os.Args[1:]))
 }
@@ -0,0 +1,267 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoEXIF - image carries no EXIF data
+var ErrNoEXIF = errors.New("no exif data")
+
+// EXIF - camera, time and location an image was taken with
+type EXIF struct {
+	Make  string `json:"make,omitempty"`
+	Model string `json:"model,omitempty"`
+	// time taken as recorded by the camera, in its local time, `2006-01-02T15:04:05`
+	Taken       string `json:"taken,omitempty"`
+	Orientation int    `json:"orientation,omitempty"`
+	GPS         *GPS   `json:"gps,omitempty"`
+}
+
+// GPS - location in decimal degrees, south and west are negative
+type GPS struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// EXIF tags read
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatRef        = 0x0001
+	tagGPSLat           = 0x0002
+	tagGPSLonRef        = 0x0003
+	tagGPSLon           = 0x0004
+)
+
+// TIFF field types read
+const (
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+// exifTime - layout of EXIF date time
+const exifTime = "2006:01:02 15:04:05"
+
+// maxEXIF - max bytes read looking for EXIF, it is in the first segments of a JPEG
+const maxEXIF = 1 << 20
+
+// FileEXIF - EXIF of JPEG file, ErrNoEXIF if it has none or isn't a JPEG
+func FileEXIF(fp string) (*EXIF, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadEXIF(io.LimitReader(file, maxEXIF))
+}
+
+// ReadEXIF - EXIF from APP1 segment of JPEG read from r
+func ReadEXIF(r io.Reader) (*EXIF, error) {
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return nil, ErrNoEXIF
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return nil, ErrNoEXIF
+		}
+		if marker[0] != 0xff {
+			return nil, ErrNoEXIF
+		}
+		// start of scan, no more metadata
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return nil, ErrNoEXIF
+		}
+
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return nil, ErrNoEXIF
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return nil, ErrNoEXIF
+		}
+
+		if marker[1] == 0xe1 && strings.HasPrefix(string(segment), "Exif\x00\x00") {
+			return parseTIFF(segment[6:])
+		}
+	}
+}
+
+// tiff - TIFF structure holding EXIF
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// field - entry of an IFD
+type field struct {
+	typ   uint16
+	count uint32
+	value []byte // inline value or value pointed to
+}
+
+func parseTIFF(data []byte) (*EXIF, error) {
+	if len(data) < 8 {
+		return nil, ErrNoEXIF
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrNoEXIF
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, ErrNoEXIF
+	}
+
+	ifd0 := t.ifd(t.order.Uint32(data[4:]))
+	if ifd0 == nil {
+		return nil, ErrNoEXIF
+	}
+
+	x := &EXIF{
+		Make:        t.ascii(ifd0[tagMake]),
+		Model:       t.ascii(ifd0[tagModel]),
+		Orientation: int(t.uint(ifd0[tagOrientation])),
+	}
+	taken := t.ascii(ifd0[tagDateTime])
+
+	if f, ok := ifd0[tagExifIFD]; ok {
+		if sub := t.ifd(t.uint(f)); sub != nil {
+			if s := t.ascii(sub[tagDateTimeOriginal]); s != "" {
+				taken = s
+			}
+		}
+	}
+	if tm, err := time.Parse(exifTime, taken); err == nil {
+		x.Taken = tm.Format("2006-01-02T15:04:05")
+	}
+
+	if f, ok := ifd0[tagGPSIFD]; ok {
+		if gps := t.ifd(t.uint(f)); gps != nil {
+			lat, okLat := t.degrees(gps[tagGPSLat])
+			lon, okLon := t.degrees(gps[tagGPSLon])
+			if okLat && okLon {
+				if t.ascii(gps[tagGPSLatRef]) == "S" {
+					lat = -lat
+				}
+				if t.ascii(gps[tagGPSLonRef]) == "W" {
+					lon = -lon
+				}
+				x.GPS = &GPS{Lat: lat, Lon: lon}
+			}
+		}
+	}
+
+	return x, nil
+}
+
+// ifd - fields of IFD at offset by tag, nil if it is out of range
+func (t *tiff) ifd(offset uint32) map[uint16]*field {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil
+	}
+
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(t.data) {
+		return nil
+	}
+
+	fields := make(map[uint16]*field, n)
+	for k := 0; k < n; k++ {
+		entry := t.data[start+k*12 : start+(k+1)*12]
+		f := &field{
+			typ:   t.order.Uint16(entry[2:]),
+			count: t.order.Uint32(entry[4:]),
+		}
+
+		size := int64(typeSize(f.typ)) * int64(f.count)
+		if size <= 4 {
+			f.value = entry[8 : 8+size]
+		} else {
+			off := int64(t.order.Uint32(entry[8:]))
+			if off+size > int64(len(t.data)) {
+				continue
+			}
+			f.value = t.data[off : off+size]
+		}
+		fields[t.order.Uint16(entry)] = f
+	}
+
+	return fields
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case typeShort:
+		return 2
+	case typeLong, 9:
+		return 4
+	case typeRational, 10, 12:
+		return 8
+	default:
+		return 1
+	}
+}
+
+func (t *tiff) ascii(f *field) string {
+	if f == nil || f.typ != typeASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(f.value), "\x00"))
+}
+
+func (t *tiff) uint(f *field) uint32 {
+	if f == nil || f.count == 0 {
+		return 0
+	}
+	switch f.typ {
+	case typeShort:
+		return uint32(t.order.Uint16(f.value))
+	case typeLong:
+		return t.order.Uint32(f.value)
+	}
+	return 0
+}
+
+// degrees - decimal degrees of rational degrees, minutes and seconds
+func (t *tiff) degrees(f *field) (float64, bool) {
+	if f == nil || f.typ != typeRational || f.count != 3 {
+		return 0, false
+	}
+
+	var deg float64
+	for k, unit := range []float64{1, 60, 3600} {
+		num := t.order.Uint32(f.value[k*8:])
+		den := t.order.Uint32(f.value[k*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		deg += float64(num) / float64(den) / unit
+	}
+	return deg, true
+}
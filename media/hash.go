@@ -0,0 +1,102 @@
+// Package media - tell duplicate and similar images among downloads
+package media
+
+import (
+	"image"
+	"math/bits"
+	"os"
+
+	// decoders of formats hashed perceptually
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// DHash - difference hash of img, 64 bits telling whether each pixel of the
+// image shrunk to 9x8 grayscale is brighter than its right neighbour.
+// Resized, recompressed or slightly retouched copies get close hashes.
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+
+	b := img.Bounds()
+	if b.Empty() {
+		return 0
+	}
+
+	var gray [h][w]float64
+	for y := 0; y < h; y++ {
+		y0, y1 := span(b.Min.Y, b.Dy(), y, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := span(b.Min.X, b.Dx(), x, w)
+			gray[y][x] = meanLuma(img, x0, x1, y0, y1)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// Distance - number of differing bits of two hashes
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Similarity - share of equal bits of two hashes, in [0, 1]
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(Distance(a, b))/64
+}
+
+// FileDHash - difference hash of image file, error if its format can't be decoded
+func FileDHash(fp string) (uint64, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, err
+	}
+
+	return DHash(img), nil
+}
+
+// span - pixel range of k-th of n cells along a side of given size
+func span(min, size, k, n int) (int, int) {
+	start := min + k*size/n
+	end := min + (k+1)*size/n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// maxSamples - max pixels sampled per side of a cell, so that large photos hash fast
+const maxSamples = 16
+
+func meanLuma(img image.Image, x0, x1, y0, y1 int) float64 {
+	stepX := (x1-x0)/maxSamples + 1
+	stepY := (y1-y0)/maxSamples + 1
+
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+
+	return sum / float64(n)
+}
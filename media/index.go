@@ -0,0 +1,433 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shohi/goinsight/util"
+)
+
+// ReportFile - name of dedupe report written to the indexed directory
+const ReportFile = "dedupe_report.json"
+
+// HashFile - name of the file keeping hashes of indexed images in the indexed
+// directory, so that only images new or changed since are hashed by the next index
+const HashFile = ".dedupe_hashes.json"
+
+// Actions taken on a download identical to an indexed file
+const (
+	ActionLink = "link" // replace it with a hard link to the indexed file
+	ActionSkip = "skip" // remove it
+	ActionNone = "none" // keep it, only report
+)
+
+// DefaultSimilarity - min similarity of perceptual hashes of near-duplicates
+const DefaultSimilarity = 0.9
+
+// imageExts - extensions of files indexed
+var imageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".bmp": true, ".tif": true, ".tiff": true,
+}
+
+// Options - how duplicates are handled
+type Options struct {
+	// one of ActionLink, ActionSkip and ActionNone, default ActionLink
+	Action string
+	// images at least this similar are reported as near-duplicates, default DefaultSimilarity
+	Similarity float64
+}
+
+// Check - check action is known
+func (o Options) Check() error {
+	switch o.Action {
+	case "", ActionLink, ActionSkip, ActionNone:
+	default:
+		return fmt.Errorf("unknown dedupe action %q", o.Action)
+	}
+	if o.Similarity < 0 || o.Similarity > 1 {
+		return fmt.Errorf("dedupe similarity %v is not in [0, 1]", o.Similarity)
+	}
+	return nil
+}
+
+// Duplicate - a file identical to an indexed one
+type Duplicate struct {
+	File     string `json:"file"`
+	Original string `json:"original"`
+	SHA256   string `json:"sha256"`
+	// action taken on File, `existing` if it was found by scan and is left as is
+	Action string `json:"action"`
+}
+
+// Similar - a file whose perceptual hash is close to an indexed one's
+type Similar struct {
+	File       string  `json:"file"`
+	Match      string  `json:"match"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Report - duplicates and near-duplicates in a directory, paths are relative to Dir
+type Report struct {
+	Dir        string       `json:"dir"`
+	Generated  time.Time    `json:"generated"`
+	Files      int          `json:"files"`
+	Duplicates []*Duplicate `json:"duplicates"`
+	Similar    []*Similar   `json:"similar"`
+}
+
+type entry struct {
+	path   string
+	sum    string
+	dhash  uint64
+	hashed bool // format can be decoded
+
+	size    int64
+	modTime time.Time
+	// hashes are kept in HashFile and the file is unchanged since
+	known bool
+}
+
+// fileHashes - hashes of an image as kept in HashFile, valid while its size
+// and modification time are unchanged
+type fileHashes struct {
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+	DHash   string    `json:"dhash,omitempty"` // hex, empty if format can't be decoded
+}
+
+// hashes - content of HashFile, near-duplicates are kept as they are only
+// found when either image is hashed
+type hashes struct {
+	Files   []*fileHashes `json:"files"`
+	Similar []*Similar    `json:"similar"`
+}
+
+// Index - content and perceptual hashes of images under a directory, safe for concurrent use
+type Index struct {
+	Dir string
+	Options
+
+	mu      sync.Mutex
+	bySum   map[string]string
+	entries []*entry
+	// every image indexed by path, including duplicates, as saved to HashFile
+	files  map[string]*entry
+	saved  map[string]*fileHashes
+	report Report
+}
+
+// NewIndex - index images under dir, duplicates found among them are reported
+// but left as they are. Hashes of images unchanged since the last Save are read
+// from HashFile, only the others are hashed and compared with the rest.
+func NewIndex(dir string, opts Options) (*Index, error) {
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+	if opts.Action == "" {
+		opts.Action = ActionLink
+	}
+	if opts.Similarity == 0 {
+		opts.Similarity = DefaultSimilarity
+	}
+
+	x := &Index{
+		Dir:     dir,
+		Options: opts,
+		bySum:   make(map[string]string),
+		files:   make(map[string]*entry),
+		saved:   make(map[string]*fileHashes),
+		report:  Report{Dir: dir, Duplicates: []*Duplicate{}, Similar: []*Similar{}},
+	}
+	similar := x.load()
+
+	var files []string
+	err := filepath.Walk(dir, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// thumbnails and other hidden files aren't downloads
+		if info.IsDir() && fp != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() && isImage(fp) {
+			files = append(files, fp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// known images first, so that each new one is compared with all of them
+	var known, unknown []*entry
+	for _, fp := range files {
+		e, err := x.hash(fp)
+		if err != nil {
+			logger.Infow("index image error", "file", fp, "error", err)
+			continue
+		}
+		if e.known {
+			known = append(known, e)
+		} else {
+			unknown = append(unknown, e)
+		}
+	}
+
+	for _, e := range known {
+		x.add(e, false)
+	}
+	for _, s := range similar {
+		a, b := x.files[filepath.Join(dir, s.File)], x.files[filepath.Join(dir, s.Match)]
+		if a != nil && a.known && b != nil && b.known && s.Similarity >= x.Similarity {
+			x.report.Similar = append(x.report.Similar, s)
+		}
+	}
+	for _, e := range unknown {
+		x.add(e, false)
+	}
+
+	return x, nil
+}
+
+// Add - index a new file, returns the duplicate it is if it is identical to an
+// indexed file, which is handled by Action, and near-duplicates of it if not
+func (x *Index) Add(fp string) (*Duplicate, []*Similar, error) {
+	if !isImage(fp) {
+		return nil, nil, nil
+	}
+
+	e, err := x.hash(fp)
+	if err != nil {
+		return nil, nil, err
+	}
+	dup, similar := x.add(e, true)
+	return dup, similar, nil
+}
+
+// hash - hashes of image fp, read from HashFile if it is unchanged since saved.
+// Decoding is the slow part, done without lock.
+func (x *Index) hash(fp string) (*entry, error) {
+	info, err := os.Stat(fp)
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{path: fp, size: info.Size(), modTime: info.ModTime()}
+
+	// saved isn't changed once loaded
+	saved := x.saved[x.rel(fp)]
+	if saved != nil && saved.Size == e.size && saved.ModTime.Equal(e.modTime) {
+		e.sum, e.known = saved.SHA256, true
+		if saved.DHash != "" {
+			e.dhash, err = strconv.ParseUint(saved.DHash, 16, 64)
+			e.hashed = err == nil
+		}
+		return e, nil
+	}
+
+	if e.sum, err = checksum(fp); err != nil {
+		return nil, err
+	}
+	if dhash, err := FileDHash(fp); err == nil {
+		e.dhash, e.hashed = dhash, true
+	}
+	return e, nil
+}
+
+// add - index e, compared with indexed images unless it is known, since its
+// near-duplicates among them were found when either was hashed
+func (x *Index) add(e *entry, isNew bool) (*Duplicate, []*Similar) {
+	fp, sum := e.path, e.sum
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.report.Files++
+	x.files[fp] = e
+
+	if original, ok := x.bySum[sum]; ok {
+		if sameFile(original, fp) {
+			// linked by an earlier run
+			return nil, nil
+		}
+
+		dup := &Duplicate{File: x.rel(fp), Original: x.rel(original), SHA256: sum, Action: "existing"}
+		if isNew {
+			dup.Action = x.handle(fp, original)
+			if dup.Action == ActionSkip {
+				delete(x.files, fp)
+			}
+		}
+		x.report.Duplicates = append(x.report.Duplicates, dup)
+		return dup, nil
+	}
+
+	x.bySum[sum] = fp
+
+	var similar []*Similar
+	if e.hashed && !e.known {
+		for _, other := range x.entries {
+			if !other.hashed {
+				continue
+			}
+			if s := Similarity(e.dhash, other.dhash); s >= x.Similarity {
+				similar = append(similar, &Similar{File: x.rel(fp), Match: x.rel(other.path), Similarity: s})
+			}
+		}
+	}
+	x.entries = append(x.entries, e)
+	x.report.Similar = append(x.report.Similar, similar...)
+
+	return nil, similar
+}
+
+// handle - take action on new file identical to original, returns the action taken
+func (x *Index) handle(fp, original string) string {
+	switch x.Action {
+	case ActionSkip:
+		if err := os.Remove(fp); err != nil {
+			logger.Infow("remove duplicate error", "file", fp, "error", err)
+			return ActionNone
+		}
+		os.Remove(fp + util.ChecksumSuffix)
+		return ActionSkip
+
+	case ActionLink:
+		// linked through a temp name, so that fp is never missing
+		tmp := fp + ".link.tmp"
+		os.Remove(tmp)
+		if err := os.Link(original, tmp); err != nil {
+			logger.Infow("link duplicate error", "file", fp, "error", err)
+			return ActionNone
+		}
+		if err := os.Rename(tmp, fp); err != nil {
+			os.Remove(tmp)
+			logger.Infow("link duplicate error", "file", fp, "error", err)
+			return ActionNone
+		}
+		return ActionLink
+	}
+
+	return ActionNone
+}
+
+// Report - duplicates and near-duplicates found so far
+func (x *Index) Report() Report {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	r := x.report
+	r.Generated = time.Now()
+	r.Duplicates = append([]*Duplicate{}, r.Duplicates...)
+	r.Similar = append([]*Similar{}, r.Similar...)
+
+	sort.Slice(r.Duplicates, func(a, b int) bool { return r.Duplicates[a].File < r.Duplicates[b].File })
+	sort.Slice(r.Similar, func(a, b int) bool {
+		if r.Similar[a].File != r.Similar[b].File {
+			return r.Similar[a].File < r.Similar[b].File
+		}
+		return r.Similar[a].Match < r.Similar[b].Match
+	})
+
+	return r
+}
+
+// WriteReport - write report to ReportFile under Dir, returns its path
+func (x *Index) WriteReport() (string, error) {
+	data, err := json.MarshalIndent(x.Report(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	fp := filepath.Join(x.Dir, ReportFile)
+	return fp, util.WriteFileAtomic(fp, data)
+}
+
+// Save - write hashes of indexed images and near-duplicates among them to
+// HashFile under Dir, returns its path
+func (x *Index) Save() (string, error) {
+	x.mu.Lock()
+	h := hashes{Files: make([]*fileHashes, 0, len(x.files)), Similar: x.report.Similar}
+	for fp, e := range x.files {
+		fh := &fileHashes{File: x.rel(fp), Size: e.size, ModTime: e.modTime, SHA256: e.sum}
+		if e.hashed {
+			fh.DHash = strconv.FormatUint(e.dhash, 16)
+		}
+		h.Files = append(h.Files, fh)
+	}
+	x.mu.Unlock()
+
+	sort.Slice(h.Files, func(a, b int) bool { return h.Files[a].File < h.Files[b].File })
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+
+	fp := filepath.Join(x.Dir, HashFile)
+	return fp, util.WriteFileAtomic(fp, data)
+}
+
+// load - read hashes saved to HashFile, returns near-duplicates saved
+func (x *Index) load() []*Similar {
+	data, err := ioutil.ReadFile(filepath.Join(x.Dir, HashFile))
+	if err != nil {
+		return nil
+	}
+
+	var h hashes
+	if err := json.Unmarshal(data, &h); err != nil {
+		logger.Infow("invalid saved hashes", "dir", x.Dir, "error", err)
+		return nil
+	}
+	for _, fh := range h.Files {
+		x.saved[fh.File] = fh
+	}
+	return h.Similar
+}
+
+func (x *Index) rel(fp string) string {
+	if rel, err := filepath.Rel(x.Dir, fp); err == nil {
+		return rel
+	}
+	return fp
+}
+
+func isImage(fp string) bool {
+	base := filepath.Base(fp)
+	return !strings.HasPrefix(base, ".") && imageExts[strings.ToLower(filepath.Ext(base))]
+}
+
+// checksum - SHA-256 of fp, read from its checksum file if it is recorded
+func checksum(fp string) (string, error) {
+	if sum, err := util.ReadChecksum(fp); err == nil {
+		return sum, nil
+	}
+	return util.FileChecksum(fp)
+}
+
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+var logger = util.NewLogger().Sugar()
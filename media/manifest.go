@@ -0,0 +1,163 @@
+package media
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shohi/goinsight/util"
+)
+
+// ManifestFile - name of manifest written to each directory of processed images
+const ManifestFile = "manifest.json"
+
+// Source - where an image comes from
+type Source struct {
+	URL string `json:"url,omitempty"`
+	// page the image is found on
+	Page string `json:"page,omitempty"`
+	// id of gallery or note holding the image
+	ID     string `json:"id,omitempty"`
+	Clicks int    `json:"clicks,omitempty"`
+}
+
+// Entry - an image in manifest, paths are relative to its directory
+type Entry struct {
+	File string `json:"file"`
+	Source
+	Size      int64  `json:"size"`
+	Format    string `json:"format,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	EXIF      *EXIF  `json:"exif,omitempty"`
+	// time the image is processed
+	Added time.Time `json:"added"`
+}
+
+// Manifest - images of a directory
+type Manifest struct {
+	Dir     string    `json:"dir"`
+	Updated time.Time `json:"updated"`
+	Files   []*Entry  `json:"files"`
+}
+
+// Manifests - manifests of directories holding processed images, loaded from
+// existing manifest files so that entries of earlier runs are kept. Safe for
+// concurrent use.
+type Manifests struct {
+	mu    sync.Mutex
+	dirs  map[string]map[string]*Entry
+	dirty map[string]bool
+}
+
+// NewManifests - create empty manifests
+func NewManifests() *Manifests {
+	return &Manifests{
+		dirs:  make(map[string]map[string]*Entry),
+		dirty: make(map[string]bool),
+	}
+}
+
+// Has - whether image file fp is in its directory's manifest
+func (m *Manifests) Has(fp string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.dir(filepath.Dir(fp))[filepath.Base(fp)]
+	return ok
+}
+
+// Set - record entry of image file fp, replacing the existing one
+func (m *Manifests) Set(fp string, e *Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir := filepath.Dir(fp)
+	e.File = filepath.Base(fp)
+	m.dir(dir)[e.File] = e
+	m.dirty[dir] = true
+}
+
+// Remove - drop entry of image file fp
+func (m *Manifests) Remove(fp string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir := filepath.Dir(fp)
+	entries := m.dir(dir)
+	if _, ok := entries[filepath.Base(fp)]; ok {
+		delete(entries, filepath.Base(fp))
+		m.dirty[dir] = true
+	}
+}
+
+// Write - write manifests changed since loaded, returns paths of written files
+func (m *Manifests) Write() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var dirs []string
+	for dir := range m.dirty {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var written []string
+	for _, dir := range dirs {
+		mf := Manifest{Dir: dir, Updated: time.Now(), Files: []*Entry{}}
+		for _, e := range m.dirs[dir] {
+			mf.Files = append(mf.Files, e)
+		}
+		sort.Slice(mf.Files, func(a, b int) bool { return mf.Files[a].File < mf.Files[b].File })
+
+		data, err := json.MarshalIndent(mf, "", "  ")
+		if err != nil {
+			return written, err
+		}
+
+		fp := filepath.Join(dir, ManifestFile)
+		if err := util.WriteFileAtomic(fp, data); err != nil {
+			return written, err
+		}
+		delete(m.dirty, dir)
+		written = append(written, fp)
+	}
+
+	return written, nil
+}
+
+// dir - entries of dir by file name, loaded from its manifest file on first use.
+// Entries of files removed since are dropped.
+func (m *Manifests) dir(dir string) map[string]*Entry {
+	if entries, ok := m.dirs[dir]; ok {
+		return entries
+	}
+
+	entries := make(map[string]*Entry)
+	m.dirs[dir] = entries
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return entries
+	}
+
+	var mf Manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		logger.Infow("invalid manifest", "dir", dir, "error", err)
+		return entries
+	}
+	for _, e := range mf.Files {
+		if _, err := os.Stat(filepath.Join(dir, e.File)); err != nil {
+			m.dirty[dir] = true
+			continue
+		}
+		entries[e.File] = e
+	}
+
+	return entries
+}
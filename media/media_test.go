@@ -0,0 +1,305 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pattern - image of diagonal stripes, brightened by delta,
+// mirrored if flip is set
+func pattern(delta int, flip bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 90, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 90; x++ {
+			px := x
+			if flip {
+				px = 89 - x
+			}
+			v := (px*7+y*3)%200 + delta
+			img.SetGray(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	return img
+}
+
+func writePNG(t *testing.T, fp string, img image.Image) {
+	file, err := os.Create(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDHash(t *testing.T) {
+	a := DHash(pattern(0, false))
+	if s := Similarity(a, DHash(pattern(30, false))); s < DefaultSimilarity {
+		t.Errorf("similarity of brightened copy is %v", s)
+	}
+	if s := Similarity(a, DHash(pattern(0, true))); s >= DefaultSimilarity {
+		t.Errorf("similarity of mirrored image is %v", s)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	orig := filepath.Join(dir, "a.png")
+	writePNG(t, orig, pattern(0, false))
+
+	x, err := NewIndex(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// exact copy is linked to the original
+	copied := filepath.Join(dir, "sub", "b.png")
+	os.MkdirAll(filepath.Dir(copied), 0755)
+	data, _ := ioutil.ReadFile(orig)
+	ioutil.WriteFile(copied, data, 0644)
+
+	dup, _, err := x.Add(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup == nil || dup.Original != "a.png" || dup.Action != ActionLink {
+		t.Fatalf("duplicate: %+v", dup)
+	}
+	if !sameFile(orig, copied) {
+		t.Errorf("duplicate is not linked")
+	}
+
+	// near-duplicate is flagged, different image is not
+	bright := filepath.Join(dir, "c.png")
+	writePNG(t, bright, pattern(30, false))
+	if dup, similar, _ := x.Add(bright); dup != nil || len(similar) != 1 || similar[0].Match != "a.png" {
+		t.Errorf("near-duplicate: %+v, %+v", dup, similar)
+	}
+
+	mirrored := filepath.Join(dir, "d.png")
+	writePNG(t, mirrored, pattern(0, true))
+	if dup, similar, _ := x.Add(mirrored); dup != nil || len(similar) != 0 {
+		t.Errorf("different image: %+v, %+v", dup, similar)
+	}
+
+	fp, err := x.WriteReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	data, _ = ioutil.ReadFile(fp)
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Files != 4 || len(r.Duplicates) != 1 || len(r.Similar) != 1 {
+		t.Errorf("report: %s", data)
+	}
+
+	// linked files aren't reported again by the next scan
+	x, err = NewIndex(dir, Options{Action: ActionSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := x.Report(); len(r.Duplicates) != 0 || len(r.Similar) != 1 {
+		t.Errorf("rescan: %+v", r)
+	}
+
+	// saved hashes are used for unchanged files, near-duplicates are kept
+	if _, err := x.Save(); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(bright, later, later)
+	x, err = NewIndex(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fp, e := range x.files {
+		if e.known != (fp != bright) {
+			t.Errorf("%s is known == %v", fp, e.known)
+		}
+	}
+	if r := x.Report(); r.Files != 4 || len(r.Duplicates) != 0 || len(r.Similar) != 1 {
+		t.Errorf("rescan with saved hashes: %+v", r)
+	}
+	x.Save()
+	if x, _ = NewIndex(dir, Options{}); len(x.Report().Similar) != 1 {
+		t.Errorf("near-duplicates of all known files aren't kept: %+v", x.Report())
+	}
+}
+
+// exifTag - tag of test TIFF, pointing to ifd ptr if it is set
+type exifTag struct {
+	id, typ uint16
+	count   uint32
+	data    []byte
+	ptr     int
+}
+
+// buildTIFF - little-endian TIFF of ifds laid out one after another, followed by values
+func buildTIFF(ifds [][]exifTag) []byte {
+	offsets := []int{8}
+	for _, ifd := range ifds {
+		offsets = append(offsets, offsets[len(offsets)-1]+2+12*len(ifd)+4)
+	}
+
+	le := binary.LittleEndian
+	head := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	var values []byte
+	for _, ifd := range ifds {
+		head = append(head, 0, 0)
+		le.PutUint16(head[len(head)-2:], uint16(len(ifd)))
+		for _, t := range ifd {
+			entry := make([]byte, 12)
+			le.PutUint16(entry, t.id)
+			le.PutUint16(entry[2:], t.typ)
+			le.PutUint32(entry[4:], t.count)
+			switch {
+			case t.ptr > 0:
+				le.PutUint32(entry[8:], uint32(offsets[t.ptr]))
+			case len(t.data) <= 4:
+				copy(entry[8:], t.data)
+			default:
+				le.PutUint32(entry[8:], uint32(offsets[len(ifds)]+len(values)))
+				values = append(values, t.data...)
+			}
+			head = append(head, entry...)
+		}
+		head = append(head, 0, 0, 0, 0)
+	}
+
+	return append(head, values...)
+}
+
+func rational(nums ...uint32) []byte {
+	data := make([]byte, 8*len(nums))
+	for k, n := range nums {
+		binary.LittleEndian.PutUint32(data[k*8:], n)
+		binary.LittleEndian.PutUint32(data[k*8+4:], 1)
+	}
+	return data
+}
+
+// jpegWithEXIF - JPEG of img with EXIF of a photo taken at 39°54'N 116°24'E
+func jpegWithEXIF(t *testing.T, img image.Image) []byte {
+	ascii := func(s string) []byte { return append([]byte(s), 0) }
+	tiff := buildTIFF([][]exifTag{
+		{
+			{id: tagMake, typ: typeASCII, count: 6, data: ascii("Canon")},
+			{id: tagModel, typ: typeASCII, count: 3, data: ascii("X1")},
+			{id: tagExifIFD, typ: typeLong, count: 1, ptr: 1},
+			{id: tagGPSIFD, typ: typeLong, count: 1, ptr: 2},
+		},
+		{
+			{id: tagDateTimeOriginal, typ: typeASCII, count: 20, data: ascii("2018:05:01 08:30:00")},
+		},
+		{
+			{id: tagGPSLatRef, typ: typeASCII, count: 2, data: ascii("N")},
+			{id: tagGPSLat, typ: typeRational, count: 3, data: rational(39, 54, 0)},
+			{id: tagGPSLonRef, typ: typeASCII, count: 2, data: ascii("E")},
+			{id: tagGPSLon, typ: typeRational, count: 3, data: rational(116, 24, 0)},
+		},
+	})
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	size := make([]byte, 2)
+	binary.BigEndian.PutUint16(size, uint16(len(app1)+2))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = append(out, size...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func TestReadEXIF(t *testing.T) {
+	x, err := ReadEXIF(bytes.NewReader(jpegWithEXIF(t, pattern(0, false))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Make != "Canon" || x.Model != "X1" || x.Taken != "2018-05-01T08:30:00" {
+		t.Errorf("exif: %+v", x)
+	}
+	if x.GPS == nil || x.GPS.Lat != 39.9 || x.GPS.Lon != 116.4 {
+		t.Errorf("gps: %+v", x.GPS)
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, pattern(0, false))
+	if _, err := ReadEXIF(&buf); err != ErrNoEXIF {
+		t.Errorf("png: %v", err)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := NewProcessor(ProcessOptions{MinWidth: 50, Thumbnail: 30})
+
+	small := filepath.Join(dir, "small.png")
+	writePNG(t, small, image.NewGray(image.Rect(0, 0, 40, 80)))
+	if _, err := p.Process(small, Source{}); err != ErrTooSmall {
+		t.Errorf("small image: %v", err)
+	}
+	if _, err := os.Stat(small); !os.IsNotExist(err) {
+		t.Errorf("small image is kept")
+	}
+
+	photo := filepath.Join(dir, "photo.jpg")
+	ioutil.WriteFile(photo, jpegWithEXIF(t, pattern(0, false)), 0644)
+	src := Source{URL: "http://img.example.com/photo.jpg", Page: "http://example.com/g/1", ID: "1", Clicks: 42}
+	e, err := p.Process(photo, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Width != 90 || e.Height != 80 || e.Format != "jpeg" || e.EXIF == nil || e.Thumbnail != ".thumbs/photo.jpg.jpg" {
+		t.Errorf("entry: %+v", e)
+	}
+
+	thumb, _, err := decodeConfig(filepath.Join(dir, e.Thumbnail))
+	if err != nil || thumb.Width != 30 || thumb.Height != 26 {
+		t.Errorf("thumbnail: %+v, %v", thumb, err)
+	}
+
+	written, err := p.WriteManifests()
+	if err != nil || len(written) != 1 {
+		t.Fatalf("manifests: %v, %v", written, err)
+	}
+
+	// entries are kept by the next run
+	if !NewProcessor(ProcessOptions{}).Has(photo) {
+		t.Errorf("photo is not in manifest")
+	}
+	var mf Manifest
+	data, _ := ioutil.ReadFile(written[0])
+	if err := json.Unmarshal(data, &mf); err != nil || len(mf.Files) != 1 || mf.Files[0].Source != src {
+		t.Errorf("manifest: %s", data)
+	}
+}
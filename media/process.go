@@ -0,0 +1,136 @@
+package media
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shohi/goinsight/util"
+)
+
+// ErrTooSmall - image is under min size and removed
+var ErrTooSmall = errors.New("image is too small")
+
+// ProcessOptions - processing of downloaded images, zero values disable each step
+type ProcessOptions struct {
+	// images narrower, lower or smaller in bytes are removed. Dimensions are
+	// only known for gif, jpeg and png.
+	MinWidth  int
+	MinHeight int
+	MinBytes  int64
+	// max side of thumbnails written to ThumbDir
+	Thumbnail int
+}
+
+// Processor - filter images by size, write their thumbnails and record them,
+// with dimensions, EXIF and source, in manifest of their directory. Safe for
+// concurrent use.
+type Processor struct {
+	ProcessOptions
+
+	manifests *Manifests
+}
+
+// NewProcessor - create processor
+func NewProcessor(opts ProcessOptions) *Processor {
+	return &Processor{ProcessOptions: opts, manifests: NewManifests()}
+}
+
+// Process - process image file fp downloaded from src, returns its manifest entry.
+// An image under min size is removed with its checksum and ErrTooSmall returned.
+// Files other than images are left alone.
+func (p *Processor) Process(fp string, src Source) (*Entry, error) {
+	if !isImage(fp) {
+		return nil, nil
+	}
+
+	info, err := os.Stat(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		Source: src,
+		Size:   info.Size(),
+		Format: strings.TrimPrefix(strings.ToLower(filepath.Ext(fp)), "."),
+		Added:  time.Now(),
+	}
+	if p.MinBytes > 0 && e.Size < p.MinBytes {
+		return nil, p.drop(fp)
+	}
+
+	if cfg, format, err := decodeConfig(fp); err == nil {
+		e.Format, e.Width, e.Height = format, cfg.Width, cfg.Height
+		if e.Width < p.MinWidth || e.Height < p.MinHeight {
+			return nil, p.drop(fp)
+		}
+	}
+
+	if x, err := FileEXIF(fp); err == nil {
+		e.EXIF = x
+	}
+
+	if p.Thumbnail > 0 {
+		if thumb, err := p.thumbnail(fp); err == nil {
+			e.Thumbnail, _ = filepath.Rel(filepath.Dir(fp), thumb)
+		} else {
+			logger.Infow("thumbnail error", "file", fp, "error", err)
+		}
+	}
+
+	p.manifests.Set(fp, e)
+	return e, nil
+}
+
+// Has - whether fp is recorded in manifest
+func (p *Processor) Has(fp string) bool {
+	return p.manifests.Has(fp)
+}
+
+// Forget - drop fp from manifest with its thumbnail, e.g. once it is removed as a duplicate
+func (p *Processor) Forget(fp string) {
+	p.manifests.Remove(fp)
+	os.Remove(ThumbPath(fp))
+}
+
+// WriteManifests - write manifests changed, returns paths of written files
+func (p *Processor) WriteManifests() ([]string, error) {
+	return p.manifests.Write()
+}
+
+func (p *Processor) thumbnail(fp string) (string, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", err
+	}
+
+	return WriteThumbnail(fp, img, p.Thumbnail)
+}
+
+func (p *Processor) drop(fp string) error {
+	if err := os.Remove(fp); err != nil {
+		return err
+	}
+	os.Remove(fp + util.ChecksumSuffix)
+	p.Forget(fp)
+	return ErrTooSmall
+}
+
+func decodeConfig(fp string) (image.Config, string, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	defer file.Close()
+
+	return image.DecodeConfig(file)
+}
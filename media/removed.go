@@ -0,0 +1,115 @@
+package media
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shohi/goinsight/util"
+)
+
+// RemovedFile - name of the record of removed downloads, kept under the download directory
+const RemovedFile = ".removed.json"
+
+// Reasons a download is removed
+const (
+	RemovedDuplicate = "duplicate" // identical to an indexed image, removed by ActionSkip
+	RemovedTooSmall  = "too_small" // under min size of post-processing
+)
+
+// Removal - a download removed once it was downloaded
+type Removal struct {
+	URL string `json:"url"`
+	// path of the file removed, relative to the download directory
+	File    string    `json:"file"`
+	Reason  string    `json:"reason"`
+	Removed time.Time `json:"removed"`
+}
+
+// Removals - downloads removed under a directory, recorded so that later runs
+// don't download them again, even without a seen store. Loaded from and written
+// to RemovedFile under Dir. Safe for concurrent use.
+type Removals struct {
+	Dir string
+
+	mu    sync.Mutex
+	urls  map[string]*Removal
+	dirty bool
+}
+
+// LoadRemovals - removals recorded under dir, empty if there is no record yet
+func LoadRemovals(dir string) (*Removals, error) {
+	r := &Removals{Dir: dir, urls: make(map[string]*Removal)}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, RemovedFile))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+
+	var list []*Removal
+	if err := json.Unmarshal(data, &list); err != nil {
+		return r, err
+	}
+	for _, e := range list {
+		r.urls[e.URL] = e
+	}
+	return r, nil
+}
+
+// Has - whether download of url was removed
+func (r *Removals) Has(url string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.urls[url]
+	return ok
+}
+
+// Add - record download of url to fp removed for reason
+func (r *Removals) Add(url, fp, reason string) {
+	if rel, err := filepath.Rel(r.Dir, fp); err == nil {
+		fp = rel
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.urls[url] = &Removal{URL: url, File: fp, Reason: reason, Removed: time.Now()}
+	r.dirty = true
+}
+
+// Write - write removals to RemovedFile under Dir if any is added,
+// returns its path, empty if nothing is written
+func (r *Removals) Write() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return "", nil
+	}
+
+	list := make([]*Removal, 0, len(r.urls))
+	for _, e := range r.urls {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].URL < list[b].URL })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	fp := filepath.Join(r.Dir, RemovedFile)
+	if err := util.WriteFileAtomic(fp, data); err != nil {
+		return fp, err
+	}
+	r.dirty = false
+	return fp, nil
+}
@@ -0,0 +1,88 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+
+	"github.com/shohi/goinsight/util"
+)
+
+// ThumbDir - directory next to images holding their thumbnails,
+// hidden so that thumbnails aren't taken as downloads
+const ThumbDir = ".thumbs"
+
+// thumbQuality - JPEG quality of thumbnails
+const thumbQuality = 80
+
+// Thumbnail - img shrunk to fit in a square of side max by averaging pixels,
+// img itself if it already fits
+func Thumbnail(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if max <= 0 || (w <= max && h <= max) {
+		return img
+	}
+
+	tw, th := max, h*max/w
+	if h > w {
+		tw, th = w*max/h, max
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := span(b.Min.Y, h, y, th)
+		for x := 0; x < tw; x++ {
+			x0, x1 := span(b.Min.X, w, x, tw)
+			dst.SetRGBA(x, y, meanColor(img, x0, x1, y0, y1))
+		}
+	}
+
+	return dst
+}
+
+// ThumbPath - path of thumbnail of image file fp, e.g. `.thumbs/a.png.jpg` for `a.png`
+func ThumbPath(fp string) string {
+	return filepath.Join(filepath.Dir(fp), ThumbDir, filepath.Base(fp)+".jpg")
+}
+
+// WriteThumbnail - write JPEG thumbnail of img decoded from fp to ThumbPath(fp),
+// returns its path
+func WriteThumbnail(fp string, img image.Image, max int) (string, error) {
+	thumb := ThumbPath(fp)
+	if err := os.MkdirAll(filepath.Dir(thumb), 0755); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Thumbnail(img, max), &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return "", err
+	}
+
+	return thumb, util.WriteFileAtomic(thumb, buf.Bytes())
+}
+
+func meanColor(img image.Image, x0, x1, y0, y1 int) color.RGBA {
+	var r, g, b, a uint64
+	var n uint64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			pr, pg, pb, pa := img.At(x, y).RGBA()
+			r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+			n++
+		}
+	}
+
+	// premultiplied 16 bit sums down to 8 bit
+	n *= 257
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+}
@@ -3,32 +3,187 @@ package router
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/shohi/goinsight/basic"
 	"github.com/shohi/goinsight/config"
-	"github.com/shohi/goinsight/special/rent"
-	"github.com/shohi/goinsight/special/tour"
+	"github.com/shohi/goinsight/store"
+	"github.com/shohi/goinsight/util"
 	"github.com/spf13/viper"
-	"go.uber.org/zap"
+
+	// register insighters
+	_ "github.com/shohi/goinsight/special/rent"
+	_ "github.com/shohi/goinsight/special/tour"
 )
 
-var logger = zap.NewExample().Sugar()
+var logger = util.NewLogger().Sugar()
+
+// Report - outcome of running one insighter
+type Report struct {
+	Type     string
+	Start    time.Time
+	Duration time.Duration
+	Result   *basic.Result
+	Err      error
+}
+
+// Route - create insighters of given types from configuration and run them
+// concurrently, sharing the same context and seen store. Duplicated types run once.
+// A report is returned for every type, in the given order.
+func Route(ctx context.Context, types []string, seen store.SeenStore) []*Report {
+	var reports []*Report
+	routed := make(map[string]bool)
+	for _, t := range types {
+		if routed[t] {
+			continue
+		}
+		routed[t] = true
+		reports = append(reports, &Report{Type: t})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(reports))
+
+	for _, r := range reports {
+		go func(r *Report) {
+			defer wg.Done()
+
+			r.Start = time.Now()
+			r.Result, r.Err = route(ctx, r.Type, seen)
+			r.Duration = time.Since(r.Start)
 
-// Route - route url from configuration
-func Route(ctx context.Context) {
-	var insighter basic.Insighter
-	t := config.BaseConfig.Type
+			if r.Result == nil {
+				r.Result = basic.NewResult()
+			}
 
-	if t == "rent-smth" {
-		insighter = rent.NewSmthRentInsighter(viper.Sub(t))
-	} else if t == "rent-tc" {
-		insighter = rent.NewTcRentInsighter(viper.Sub(t))
-	} else if t == "tour-mfw" {
-		insighter = tour.NewMfwTourInsighter(viper.Sub(t))
-	} else {
-		insighter = basic.NewJSONImageInsighter(viper.Sub(t))
+			if r.Err != nil {
+				logger.Errorw("insight failed", "type", r.Type, "error", r.Err)
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	return reports
+}
+
+// route - run insighter of given type, panic is recovered as error
+// so that other insighters are not affected
+func route(ctx context.Context, t string, seen store.SeenStore) (res *basic.Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	v := config.Sub(t)
+	// keys of each section are kept apart, and taken as new again under its policy
+	seen = store.WithPolicy(store.Namespace(seen, t), seenPolicy(v))
+	insighter, err := basic.New(t, v, seen)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Infow("route", "type", t)
-	insighter.Insight(ctx)
+	// requests of the run share cookies, see basic.WithCookieJar
+	res, err = insighter.Insight(basic.WithCookieJar(ctx))
+
+	// record urls failed finally, so that they can be retried later
+	var cfg config.CommonConfig
+	if res != nil && v.Unmarshal(&cfg) == nil {
+		if e := basic.WriteFailures(cfg, res); e != nil {
+			logger.Infow("write failures error", "type", t, "error", e)
+		}
+	}
+
+	return res, err
+}
+
+// seenPolicy - policy set in `Seen` table of section v
+func seenPolicy(v *viper.Viper) store.Policy {
+	var cfg config.CommonConfig
+	if v == nil || v.Unmarshal(&cfg) != nil {
+		return store.Policy{}
+	}
+	return store.Policy{TTL: cfg.Seen.TTL, Resurface: cfg.Seen.Resurface}
+}
+
+// Failure - why the run of r failed, nil if it didn't. Besides an error returned
+// by the insighter, a run whose requests or downloads failed finally, with nothing
+// new collected or downloaded, fails, e.g. once a site blocks every request.
+func (r *Report) Failure() error {
+	if r.Err != nil || r.Result == nil {
+		return r.Err
+	}
+
+	res := r.Result
+	if len(res.Failures) > 0 && res.ItemsNew == 0 && res.Downloads.Done == 0 {
+		return fmt.Errorf("%d requests failed, nothing new", len(res.Failures))
+	}
+	return nil
+}
+
+// Failed - whether any insighter in reports failed, see Report.Failure
+func Failed(reports []*Report) bool {
+	for _, r := range reports {
+		if r.Failure() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintSummary - print one line for each report, followed by output files
+func PrintSummary(w io.Writer, reports []*Report) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tSTATUS\tDURATION\tPAGES\tPARSED\tFILTERED\tNEW\tDUPLICATE\tBYTES\tERRORS\tFAILURE")
+
+	for _, r := range reports {
+		res := r.Result
+		if res == nil {
+			res = basic.NewResult()
+		}
+
+		status, errMsg := "ok", ""
+		if err := r.Failure(); err != nil {
+			status, errMsg = "failed", err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			r.Type, status, r.Duration.Round(time.Millisecond),
+			res.PagesVisited, res.ItemsParsed, res.ItemsFiltered, res.ItemsNew, res.ItemsDuplicate,
+			res.BytesDownloaded, res.ErrorsString(), errMsg)
+	}
+
+	tw.Flush()
+
+	for _, r := range reports {
+		if r.Result == nil {
+			continue
+		}
+		for _, fp := range r.Result.Outputs {
+			fmt.Fprintf(w, "%s: %s\n", r.Type, fp)
+		}
+
+		if r.Result.Downloads.Total() > 0 {
+			fmt.Fprintf(w, "%s: %s\n", r.Type, r.Result.Downloads)
+		}
+
+		proxies := make([]string, 0, len(r.Result.Proxies))
+		for proxy := range r.Result.Proxies {
+			proxies = append(proxies, proxy)
+		}
+		sort.Strings(proxies)
+		for _, proxy := range proxies {
+			u := r.Result.Proxies[proxy]
+			state := ""
+			if u.Down {
+				state = " out-of-rotation"
+			}
+			fmt.Fprintf(w, "%s: proxy %s requests=%d failures=%d%s\n", r.Type, proxy, u.Requests, u.Failures, state)
+		}
+	}
 }
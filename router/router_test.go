@@ -0,0 +1,90 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/store"
+	"github.com/spf13/viper"
+)
+
+func TestRouteUnknown(t *testing.T) {
+	reports := Route(context.Background(), []string{"unknown", "unknown", "rent-smth"}, store.NewMemory())
+
+	if len(reports) != 2 {
+		t.Fatalf("Route returned %d reports, want 2", len(reports))
+	}
+
+	for _, r := range reports {
+		if r.Err == nil {
+			t.Errorf("report of %q should have error", r.Type)
+		}
+	}
+
+	if !Failed(reports) {
+		t.Error("Failed(reports) == false, want true")
+	}
+
+	var buf bytes.Buffer
+	PrintSummary(&buf, reports)
+	if !strings.Contains(buf.String(), "unknown") || !strings.Contains(buf.String(), "failed") {
+		t.Errorf("summary %q should report failed type", buf.String())
+	}
+}
+
+type fakeInsighter struct{}
+
+func (fakeInsighter) Insight(ctx context.Context) (*basic.Result, error) {
+	res := basic.NewResult()
+	res.AddPage(10)
+	res.AddNew()
+	res.AddOutput("fake.xlsx")
+	return res, nil
+}
+
+func TestRouteResult(t *testing.T) {
+	basic.Register("fake", func(v *viper.Viper, _ store.SeenStore) (basic.Insighter, error) {
+		return fakeInsighter{}, nil
+	})
+	viper.Set("fake", map[string]interface{}{"url": ""})
+
+	reports := Route(context.Background(), []string{"fake"}, store.NewMemory())
+	if Failed(reports) {
+		t.Fatalf("Route(fake) failed: %v", reports[0].Err)
+	}
+
+	res := reports[0].Result
+	if res.PagesVisited != 1 || res.ItemsNew != 1 {
+		t.Errorf("Route(fake) result == %+v, want 1 page and 1 new item", res)
+	}
+
+	var buf bytes.Buffer
+	PrintSummary(&buf, reports)
+	if !strings.Contains(buf.String(), "fake.xlsx") {
+		t.Errorf("summary %q should list output files", buf.String())
+	}
+}
+
+func TestFailedRequests(t *testing.T) {
+	res := basic.NewResult()
+	res.AddFailure("http://example.com/1", basic.ErrStatus, errors.New("403"))
+	reports := []*Report{{Type: "fake", Result: res}}
+
+	if !Failed(reports) {
+		t.Error("run with failed requests and nothing new should fail")
+	}
+	var buf bytes.Buffer
+	PrintSummary(&buf, reports)
+	if !strings.Contains(buf.String(), "1 requests failed") {
+		t.Errorf("summary %q should tell failed requests", buf.String())
+	}
+
+	res.AddNew()
+	if Failed(reports) {
+		t.Error("run with failed requests but new items should not fail")
+	}
+}
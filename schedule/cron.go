@@ -0,0 +1,235 @@
+// Package schedule - trigger jobs periodically based on cron expressions
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule - tell the next activation time after given time
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// cronSchedule - standard 5-field cron schedule, each field is a bit set
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// day of month and day of week are OR-ed when both are restricted
+	domStar, dowStar bool
+}
+
+// everySchedule - fixed interval schedule, e.g. `@every 1h30m`
+type everySchedule struct {
+	interval time.Duration
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{0, 6, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse - parse cron expression, which is either 5 fields
+// `minute hour day-of-month month day-of-week`, a descriptor like `@daily`
+// or `@every <duration>`. Fields support `*`, lists, ranges and steps,
+// e.g. `*/15 8-22 * * mon-fri`.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval should be at least 1s", spec)
+		}
+		return everySchedule{d}, nil
+	}
+
+	if expr, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	var err error
+	s := &cronSchedule{}
+	parsers := []struct {
+		field *uint64
+		b     bounds
+	}{
+		{&s.minute, minuteBounds},
+		{&s.hour, hourBounds},
+		{&s.dom, domBounds},
+		{&s.month, monthBounds},
+		{&s.dow, dowBounds},
+	}
+
+	for k, p := range parsers {
+		*p.field, err = parseField(fields[k], p.b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+	}
+
+	// `7` is also sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return s, nil
+}
+
+// parseField - parse comma separated list of `*`, `a`, `a-b`, each with optional `/step`
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangeStr, step := part, uint(1)
+
+		if k := strings.Index(part, "/"); k >= 0 {
+			n, err := strconv.ParseUint(part[k+1:], 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangeStr, step = part[:k], uint(n)
+		}
+
+		var start, end uint
+		switch {
+		case rangeStr == "*" || rangeStr == "?":
+			start, end = b.min, b.max
+		case strings.Contains(rangeStr, "-"):
+			ends := strings.SplitN(rangeStr, "-", 2)
+			var err error
+			if start, err = parseValue(ends[0], b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(ends[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseValue(rangeStr, b)
+			if err != nil {
+				return 0, err
+			}
+			start, end = v, v
+			// `a/step` means from a to max
+			if step > 1 {
+				end = b.max
+			}
+		}
+
+		if start > end {
+			return 0, fmt.Errorf("invalid range %q", rangeStr)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+
+	max := b.max
+	// allow `7` as sunday in day-of-week
+	if b.max == dowBounds.max && b.min == dowBounds.min {
+		max = 7
+	}
+	if uint(n) < b.min || uint(n) > max {
+		return 0, fmt.Errorf("value %q out of range [%d, %d]", s, b.min, b.max)
+	}
+
+	return uint(n), nil
+}
+
+// Next - next activation time after given time, zero time if none in 5 years
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	// start from the next whole minute
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next - given time plus interval, rounded to second
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval).Truncate(time.Second)
+}
@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 1ms",
+		"@every abc",
+	}
+
+	for _, c := range cases {
+		if _, err := Parse(c); err == nil {
+			t.Errorf("Parse(%q) should return error", c)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	base := time.Date(2018, time.January, 1, 10, 30, 15, 0, time.Local) // monday
+
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.January, 1, 10, 31, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2018, time.January, 1, 10, 45, 0, 0, time.Local)},
+		{"0 8-22/2 * * *", time.Date(2018, time.January, 1, 12, 0, 0, 0, time.Local)},
+		{"0 9 * * mon-fri", time.Date(2018, time.January, 2, 9, 0, 0, 0, time.Local)},
+		{"30 10 * * 7", time.Date(2018, time.January, 7, 10, 30, 0, 0, time.Local)},
+		{"0 0 1 feb *", time.Date(2018, time.February, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 13 * fri", time.Date(2018, time.January, 5, 0, 0, 0, 0, time.Local)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.Local)},
+		{"@daily", time.Date(2018, time.January, 2, 0, 0, 0, 0, time.Local)},
+		{"@hourly", time.Date(2018, time.January, 1, 11, 0, 0, 0, time.Local)},
+		{"@every 1h", time.Date(2018, time.January, 1, 11, 30, 15, 0, time.Local)},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", c.spec, err)
+			continue
+		}
+
+		got := s.Next(base)
+		if !got.Equal(c.want) {
+			t.Errorf("Parse(%q).Next(%v) == %v, want %v", c.spec, base, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/shohi/goinsight/util"
+)
+
+var logger = util.NewLogger().Sugar()
+
+// Job - a named task triggered by its schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+
+	// random delay in [0, Jitter) added to every activation
+	Jitter time.Duration
+
+	// context of each run is cancelled after MaxRuntime, zero means no limit
+	MaxRuntime time.Duration
+
+	Run func(ctx context.Context) error
+}
+
+// Run - trigger jobs on their schedules until ctx is done, then wait for
+// running jobs to return. A job never overlaps with itself, activations
+// which pass while its previous run is still going are skipped.
+func Run(ctx context.Context, jobs []*Job) {
+	var wg sync.WaitGroup
+	wg.Add(len(jobs))
+
+	for _, job := range jobs {
+		go func(j *Job) {
+			defer wg.Done()
+			loop(ctx, j)
+		}(job)
+	}
+
+	wg.Wait()
+}
+
+func loop(ctx context.Context, j *Job) {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		now := time.Now()
+		next := j.Schedule.Next(now)
+		if next.IsZero() {
+			logger.Warnw("no next activation, job stopped", "job", j.Name)
+			return
+		}
+
+		delay := next.Sub(now)
+		if j.Jitter > 0 {
+			delay += time.Duration(rnd.Int63n(int64(j.Jitter)))
+		}
+		logger.Infow("job scheduled", "job", j.Name, "next", now.Add(delay).Format(time.RFC3339))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runOnce(ctx, j)
+
+		if missed := countMissed(j.Schedule, next, time.Now()); missed > 0 {
+			logger.Warnw("activations skipped while job was running", "job", j.Name, "skipped", missed)
+		}
+	}
+}
+
+func runOnce(ctx context.Context, j *Job) {
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if j.MaxRuntime > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, j.MaxRuntime)
+	}
+	defer cancel()
+
+	start := time.Now()
+	logger.Infow("job started", "job", j.Name)
+
+	err := j.Run(runCtx)
+	if err == nil && runCtx.Err() == context.DeadlineExceeded {
+		err = runCtx.Err()
+	}
+
+	if err != nil {
+		logger.Errorw("job failed", "job", j.Name, "duration", time.Since(start), "error", err)
+		return
+	}
+	logger.Infow("job finished", "job", j.Name, "duration", time.Since(start))
+}
+
+// countMissed - number of activations in (from, to]
+func countMissed(s Schedule, from, to time.Time) int {
+	n := 0
+	for t := s.Next(from); !t.IsZero() && !t.After(to); t = s.Next(t) {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// intervalSchedule - sub-second schedule for testing
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func TestRunNoOverlap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var running, overlapped, runs int32
+	job := &Job{
+		Name:       "test",
+		Schedule:   intervalSchedule(5 * time.Millisecond),
+		MaxRuntime: 30 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+			defer atomic.AddInt32(&running, -1)
+
+			atomic.AddInt32(&runs, 1)
+			<-ctx.Done()
+			return nil
+		},
+	}
+
+	Run(ctx, []*Job{job})
+
+	if overlapped != 0 {
+		t.Error("job runs should not overlap")
+	}
+	if runs < 2 {
+		t.Errorf("job ran %d times, want at least 2", runs)
+	}
+}
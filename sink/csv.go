@@ -0,0 +1,41 @@
+package sink
+
+import (
+	"encoding/csv"
+	"os"
+)
+
+func init() {
+	Register("csv", writeCSV)
+}
+
+func writeCSV(t *Table, base string) (string, error) {
+	fp := base + ".csv"
+	file, err := os.Create(fp)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err = w.Write(t.Header); err != nil {
+		return "", err
+	}
+
+	record := make([]string, len(t.Header))
+	for _, row := range t.Rows {
+		for k, v := range row {
+			record[k] = formatText(v)
+		}
+		if err = w.Write(record); err != nil {
+			return "", err
+		}
+	}
+
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return "", err
+	}
+
+	return fp, file.Close()
+}
@@ -0,0 +1,41 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+func init() {
+	Register("jsonl", writeJSONLines)
+}
+
+// writeJSONLines - one json object per row, keyed by header
+func writeJSONLines(t *Table, base string) (string, error) {
+	fp := base + ".jsonl"
+	file, err := os.Create(fp)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	for _, row := range t.Rows {
+		obj := make(map[string]interface{}, len(t.Header))
+		for k, v := range row {
+			obj[t.Header[k]] = v
+		}
+		if err = enc.Encode(obj); err != nil {
+			return "", err
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		return "", err
+	}
+
+	return fp, file.Close()
+}
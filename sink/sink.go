@@ -0,0 +1,175 @@
+// Package sink - write collected records to files or terminal in various formats
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeLayout - layout of time values in text formats
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Table - records to be written, one row per record
+type Table struct {
+	Header []string
+	Rows   [][]interface{}
+}
+
+// Writer - write table to `base + extension` and return the written path
+type Writer func(t *Table, base string) (string, error)
+
+var (
+	writersMu sync.RWMutex
+	writers   = make(map[string]Writer)
+)
+
+// Register - make a writer available by format name
+func Register(format string, w Writer) {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+
+	if _, dup := writers[format]; dup {
+		panic("sink: Register called twice for format " + format)
+	}
+	writers[format] = w
+}
+
+// Formats - sorted names of all registered formats
+func Formats() []string {
+	writersMu.RLock()
+	defer writersMu.RUnlock()
+
+	formats := make([]string, 0, len(writers))
+	for format := range writers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// Check - check all formats are registered
+func Check(formats []string) error {
+	for _, format := range formats {
+		writersMu.RLock()
+		_, ok := writers[format]
+		writersMu.RUnlock()
+
+		if !ok {
+			return fmt.Errorf("unknown output format %q, known formats: [%s]",
+				format, strings.Join(Formats(), ", "))
+		}
+	}
+	return nil
+}
+
+// Write - write table in each format to `base + extension`, return written paths.
+// Writing goes on with other formats if one fails, the first error is returned.
+func Write(t *Table, base string, formats []string) ([]string, error) {
+	if err := Check(formats); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(base), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	var firstErr error
+
+	for _, format := range formats {
+		writersMu.RLock()
+		w := writers[format]
+		writersMu.RUnlock()
+
+		fp, err := w(t, base)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("write %s error: %v", format, err)
+			}
+			continue
+		}
+		paths = append(paths, fp)
+	}
+
+	return paths, firstErr
+}
+
+// FromStructs - build table from slice of structs or struct pointers.
+// Header is taken from `csv` tags, falling back to field names,
+// fields tagged with `csv:"-"` and unexported fields are skipped.
+func FromStructs(records interface{}) (*Table, error) {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("records should be a slice, got %s", v.Kind())
+	}
+
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("records should be a slice of structs, got %s", v.Type())
+	}
+
+	t := &Table{}
+	var fields []int
+	for k := 0; k < elemType.NumField(); k++ {
+		f := elemType.Field(k)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("csv"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		t.Header = append(t.Header, name)
+		fields = append(fields, k)
+	}
+
+	for k := 0; k < v.Len(); k++ {
+		elem := v.Index(k)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+
+		row := make([]interface{}, 0, len(fields))
+		for _, idx := range fields {
+			row = append(row, elem.Field(idx).Interface())
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t, nil
+}
+
+// formatText - text form of a value in csv and stdout tables
+func formatText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if val.IsZero() {
+			return ""
+		}
+		return val.Format(TimeLayout)
+	case string:
+		return val
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
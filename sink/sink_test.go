@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type record struct {
+	Title  string    `csv:"title"`
+	Rental float64   `csv:"rental"`
+	Last   time.Time `csv:"last"`
+	Note   string    `csv:"-"`
+	hidden int
+}
+
+func testTable(t *testing.T) *Table {
+	last := time.Date(2018, 3, 1, 8, 30, 0, 0, time.Local)
+	tbl, err := FromStructs([]*record{
+		{Title: "room, south", Rental: 2500, Last: last, Note: "skip"},
+		nil,
+		{Title: "second", Rental: 3000.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tbl
+}
+
+func TestFromStructs(t *testing.T) {
+	tbl := testTable(t)
+
+	if got := strings.Join(tbl.Header, ","); got != "title,rental,last" {
+		t.Errorf("unexpected header: %s", got)
+	}
+	if len(tbl.Rows) != 2 {
+		t.Fatalf("expect 2 rows, got %d", len(tbl.Rows))
+	}
+
+	if _, err := FromStructs("not a slice"); err == nil {
+		t.Error("expect error for non slice records")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	base := filepath.Join(dir, "out", "rent_")
+	paths, err := Write(testTable(t), base, []string{"csv", "jsonl", "xlsx", "stdout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{base + ".csv", base + ".jsonl", base + ".xlsx", "-"}
+	if strings.Join(paths, "|") != strings.Join(expected, "|") {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	data, _ := ioutil.ReadFile(base + ".csv")
+	expectedCSV := "title,rental,last\n\"room, south\",2500,2018-03-01 08:30:00\nsecond,3000.5,\n"
+	if string(data) != expectedCSV {
+		t.Errorf("unexpected csv:\n%s", data)
+	}
+
+	data, _ = ioutil.ReadFile(base + ".jsonl")
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"title":"second"`) {
+		t.Errorf("unexpected jsonl:\n%s", data)
+	}
+
+	if !strings.Contains(buf.String(), "TITLE") || !strings.Contains(buf.String(), "room, south") {
+		t.Errorf("unexpected stdout table:\n%s", buf.String())
+	}
+
+	if _, err := Write(testTable(t), base, []string{"pdf"}); err == nil {
+		t.Error("expect error for unknown format")
+	}
+}
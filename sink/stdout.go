@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+var (
+	stdoutMu sync.Mutex
+
+	// stdout - destination of `stdout` format, replaceable in tests
+	stdout io.Writer = os.Stdout
+)
+
+func init() {
+	Register("stdout", writeStdout)
+}
+
+// writeStdout - print aligned table titled with base name, returns "-" as path
+func writeStdout(t *Table, base string) (string, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+
+	fmt.Fprintf(stdout, "== %s (%d rows)\n", base, len(t.Rows))
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.Header, "\t")))
+
+	cells := make([]string, len(t.Header))
+	for _, row := range t.Rows {
+		for k, v := range row {
+			// keep one row per line
+			cells[k] = strings.Join(strings.Fields(formatText(v)), " ")
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return "-", tw.Flush()
+}
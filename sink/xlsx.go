@@ -0,0 +1,33 @@
+package sink
+
+import (
+	"github.com/tealeg/xlsx"
+)
+
+func init() {
+	Register("xlsx", writeXLSX)
+}
+
+func writeXLSX(t *Table, base string) (string, error) {
+	fp := base + ".xlsx"
+
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("Sheet1")
+	if err != nil {
+		return "", err
+	}
+
+	headRow := sheet.AddRow()
+	for _, name := range t.Header {
+		headRow.AddCell().SetValue(name)
+	}
+
+	for _, data := range t.Rows {
+		row := sheet.AddRow()
+		for _, v := range data {
+			row.AddCell().SetValue(v)
+		}
+	}
+
+	return fp, file.Save(fp)
+}
@@ -1,18 +1,22 @@
 package rent
 
 import (
+	"context"
 	"log"
 	"testing"
 
 	"github.com/shohi/goinsight/config"
 )
 
-func testGetPages(t *testing.T) {
-	cfg := config.TcRentConfig{}
+func testGanjiGetPages(t *testing.T) {
+	cfg := config.GanjiRentConfig{}
 	cfg.URL = "http://bj.58.com/chaoyang/hezu/0/pn%d/?minprice=1800_4000"
 
-	var s = &TcRentInsighter{Config: cfg}
-	log.Println(s.getPageURLs())
-	log.Println(len(s.pageURLs))
-	log.Println(s.pageURLs[0])
+	var s = &GanjiRentInsighter{Config: cfg}
+	urls, err := s.paginator().Pages(context.Background())
+	log.Println(err)
+	log.Println(len(urls))
+	if len(urls) > 0 {
+		log.Println(urls[0])
+	}
 }
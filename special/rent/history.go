@@ -0,0 +1,210 @@
+package rent
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
+)
+
+// Kinds of Change
+const (
+	ChangePriceDrop = "price_drop"
+	ChangePriceRise = "price_rise"
+	ChangeTitle     = "title_edit"
+	ChangeGone      = "disappeared" // not found by a complete run, likely rented
+)
+
+// historyNamespace - namespace of listing history in the store of an insighter,
+// keyed by link of the listing
+const historyNamespace = "history"
+
+// runKey - key in history recording complete runs, the last observation holds
+// the start of the last one
+const runKey = "_run"
+
+// Change - change of a listing since the previous run
+type Change struct {
+	Change         string  `csv:"change"`
+	Title          string  `csv:"title"`
+	Rental         float64 `csv:"rental"`
+	PreviousTitle  string  `csv:"previous_title"`
+	PreviousRental float64 `csv:"previous_rental"`
+	Href           string  `csv:"href"`
+}
+
+// history - observations of listings across runs, which tell how they changed
+type history struct {
+	s     store.SeenStore
+	start time.Time
+	// start of the last complete run, zero if there is none
+	last time.Time
+
+	mu      sync.Mutex
+	changes []*Change
+}
+
+// newHistory - history of listings kept in seen, for a run starting now
+func newHistory(seen store.SeenStore) (*history, error) {
+	h := &history{s: store.Namespace(seen, historyNamespace), start: time.Now()}
+
+	r, err := h.s.Get(runKey)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil && r.Observed() != nil {
+		h.last, _ = time.Parse(time.RFC3339Nano, r.Observed().Fields["start"])
+	}
+	return h, nil
+}
+
+// observe - record title and rental of listing at href, returns the rental before
+// the current one, zero if it never changed, and whether it changed since the last run
+func (h *history) observe(href, title string, rental float64) (float64, bool, error) {
+	// rental isn't known, e.g. it can't be parsed
+	if rental <= 0 {
+		return 0, false, nil
+	}
+
+	key := listingKey(href)
+	r, err := h.s.Get(key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	fields := map[string]string{"title": title, "rental": formatRental(rental)}
+	if _, err := h.s.MarkWithMeta(key, store.Meta{Source: href, Fields: fields}); err != nil {
+		return 0, false, err
+	}
+
+	// listing is new, or is found again by this run
+	if r == nil || r.Observed() == nil || !r.Observed().Last.Before(h.start) {
+		return previousRental(r, rental), false, nil
+	}
+
+	o := r.Observed()
+	base := Change{
+		Title:          title,
+		Rental:         rental,
+		PreviousTitle:  o.Fields["title"],
+		PreviousRental: parseRental(o.Fields["rental"]),
+		Href:           href,
+	}
+
+	var kinds []string
+	switch {
+	case rental < base.PreviousRental:
+		kinds = append(kinds, ChangePriceDrop)
+	case rental > base.PreviousRental:
+		kinds = append(kinds, ChangePriceRise)
+	}
+	if title != base.PreviousTitle {
+		kinds = append(kinds, ChangeTitle)
+	}
+	for _, kind := range kinds {
+		c := base
+		c.Change = kind
+		h.add(&c)
+	}
+
+	return previousRental(r, rental), rental != base.PreviousRental, nil
+}
+
+func (h *history) add(c *Change) {
+	h.mu.Lock()
+	h.changes = append(h.changes, c)
+	h.mu.Unlock()
+}
+
+// disappeared - listings seen by the last complete run but not by this one
+func (h *history) disappeared() error {
+	if h.last.IsZero() {
+		return nil
+	}
+
+	return h.s.Scan("", func(key string, r *store.Record) error {
+		if key == runKey || r.LastSeen.Before(h.last) || !r.LastSeen.Before(h.start) {
+			return nil
+		}
+
+		c := &Change{Change: ChangeGone, Href: r.Source}
+		if o := r.Observed(); o != nil {
+			c.Title, c.Rental = o.Fields["title"], parseRental(o.Fields["rental"])
+		}
+		h.add(c)
+		return nil
+	})
+}
+
+// report - write changes found by the run to `DownloadDir/<prefix>changes_<timestamp>`.
+// Listings disappeared are only told by a complete run, which is recorded for the next one.
+func (h *history) report(cfg config.CommonConfig, prefix string, complete bool, res *basic.Result) error {
+	if complete {
+		if err := h.disappeared(); err != nil {
+			res.AddError(basic.ErrDB)
+			return err
+		}
+
+		start := map[string]string{"start": h.start.Format(time.RFC3339Nano)}
+		if _, err := h.s.MarkWithMeta(runKey, store.Meta{Fields: start}); err != nil {
+			res.AddError(basic.ErrDB)
+			return err
+		}
+	}
+
+	if len(h.changes) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, c := range h.changes {
+		counts[c.Change]++
+	}
+	logger.Infow("listings changed", "price_drop", counts[ChangePriceDrop], "price_rise", counts[ChangePriceRise],
+		"title_edit", counts[ChangeTitle], "disappeared", counts[ChangeGone])
+
+	sort.SliceStable(h.changes, func(i, j int) bool {
+		if h.changes[i].Change != h.changes[j].Change {
+			return h.changes[i].Change < h.changes[j].Change
+		}
+		return h.changes[i].Href < h.changes[j].Href
+	})
+	return basic.WriteOutputs(cfg, prefix+"changes_", h.changes, res)
+}
+
+// listingKey - link of listing without query and fragment, which may differ between pages
+func listingKey(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String()
+}
+
+// previousRental - rental of r before the current one, zero if it never changed
+func previousRental(r *store.Record, current float64) float64 {
+	if r == nil {
+		return 0
+	}
+	for k := len(r.History) - 1; k >= 0; k-- {
+		if v := parseRental(r.History[k].Fields["rental"]); v != current {
+			return v
+		}
+	}
+	return 0
+}
+
+func formatRental(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func parseRental(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
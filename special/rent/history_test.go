@@ -0,0 +1,70 @@
+package rent
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CommonConfig{DownloadDir: dir, Outputs: []string{"csv"}}
+	seen := store.NewMemory()
+	run := func(listings map[string]float64, titles map[string]string) *history {
+		h, err := newHistory(seen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for href, rental := range listings {
+			h.observe(href, titles[href], rental)
+		}
+		if err := h.report(cfg, "test_", true, basic.NewResult()); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	h := run(map[string]float64{"http://a.com/1?from=list": 3000, "http://a.com/2": 4000},
+		map[string]string{"http://a.com/1?from=list": "one", "http://a.com/2": "two"})
+	if len(h.changes) != 0 {
+		t.Errorf("changes of first run: %+v", h.changes)
+	}
+
+	// 1 is found by another link with rental and title changed, 2 is gone
+	h = run(map[string]float64{"http://a.com/1?from=search": 2800},
+		map[string]string{"http://a.com/1?from=search": "one, cheaper"})
+	want := []string{ChangeGone, ChangePriceDrop, ChangeTitle}
+	if len(h.changes) != len(want) {
+		t.Fatalf("changes of second run: %+v", h.changes)
+	}
+	for k, c := range h.changes {
+		if c.Change != want[k] {
+			t.Errorf("change %d == %+v, want %s", k, c, want[k])
+		}
+	}
+	if c := h.changes[1]; c.PreviousRental != 3000 || c.Rental != 2800 || c.PreviousTitle != "one" {
+		t.Errorf("price drop: %+v", c)
+	}
+
+	// previous rental is kept while it doesn't change again, 2 is reported gone once
+	h, err = newHistory(seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev, repriced, _ := h.observe("http://a.com/1", "one, cheaper", 2800); prev != 3000 || repriced {
+		t.Errorf("previous rental == %v, %v, want 3000 not changed", prev, repriced)
+	}
+	h.report(cfg, "test_", true, basic.NewResult())
+	if len(h.changes) != 0 {
+		t.Errorf("changes of third run: %+v", h.changes)
+	}
+}
@@ -0,0 +1,122 @@
+package rent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/shohi/goinsight/util"
+)
+
+// env of nForum account, overriding the one in config
+const (
+	envSmthUser     = "GOINSIGHT_SMTH_USER"
+	envSmthPassword = "GOINSIGHT_SMTH_PASSWORD"
+)
+
+const nforumLoginPath = "/nForum/user/ajax_login.json"
+
+// texts of nForum pages asking for login, either html or ajax json
+var nforumLoginRequired = []string{"您未登录", "请登录后", "请先登录"}
+
+// nforumLoginResult - response of ajax login
+type nforumLoginResult struct {
+	Status  int    `json:"ajax_st"`
+	Code    string `json:"ajax_code"`
+	Message string `json:"ajax_msg"`
+}
+
+// nforumSession - login session of nForum at baseURL, e.g. `http://www.newsmth.net`.
+// Session cookies are kept by the cookie jar of the transport.
+func nforumSession(baseURL, user, password string) *util.Session {
+	return &util.Session{
+		Login: func(ctx context.Context, rt http.RoundTripper) error {
+			return nforumLogin(ctx, rt, baseURL, user, password)
+		},
+		Expired: nforumExpired,
+	}
+}
+
+func nforumLogin(ctx context.Context, rt http.RoundTripper, baseURL, user, password string) error {
+	form := url.Values{}
+	form.Set("id", user)
+	form.Set("passwd", password)
+	// session cookie, dropped when the session ends on the site
+	form.Set("CookieDate", "0")
+
+	req, err := http.NewRequest("POST", baseURL+nforumLoginPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	resp, err := rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nforum login: unexpected status %d", resp.StatusCode)
+	}
+
+	var res nforumLoginResult
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("nforum login: %v", err)
+	}
+	if res.Status != 1 {
+		return fmt.Errorf("nforum login of %s failed: %s %s", user, res.Code, res.Message)
+	}
+
+	return nil
+}
+
+// nforumExpired - whether page asks for login, body is restored for later reads
+func nforumExpired(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.URL.Path == nforumLoginPath {
+		return false
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "html") && !strings.Contains(contentType, "json") {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	for _, text := range nforumLoginRequired {
+		if bytes.Contains(body, []byte(text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// credentials - nForum account of config, overridden by env
+func (s *SmthRentInsighter) credentials() (user, password string, err error) {
+	user, password = s.Config.User, s.Config.Password
+	if v := os.Getenv(envSmthUser); v != "" {
+		user = v
+	}
+	if v := os.Getenv(envSmthPassword); v != "" {
+		password = v
+	}
+
+	if user != "" && password == "" {
+		return "", "", errors.New("password of nforum user " + user + " is empty")
+	}
+	return user, password, nil
+}
@@ -0,0 +1,97 @@
+package rent
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shohi/goinsight/basic"
+	"github.com/shohi/goinsight/config"
+)
+
+// fakeNForum - nForum accepting user alice, whose sessions can be expired
+type fakeNForum struct {
+	mu     sync.Mutex
+	logins int
+	key    string
+}
+
+func (f *fakeNForum) expire() {
+	f.mu.Lock()
+	f.key = ""
+	f.mu.Unlock()
+}
+
+func (f *fakeNForum) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case nforumLoginPath:
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostFormValue("id") != "alice" || r.PostFormValue("passwd") != "secret" {
+			w.Write([]byte(`{"ajax_st":0,"ajax_code":"0101","ajax_msg":"wrong password"}`))
+			return
+		}
+		f.logins++
+		f.key = strconv.Itoa(f.logins)
+		w.Header().Add("Set-Cookie", "main[UTMPUSERID]=alice; path=/")
+		w.Header().Add("Set-Cookie", "main[UTMPKEY]="+f.key+"; path=/")
+		w.Write([]byte(`{"ajax_st":1,"ajax_code":"0005","ajax_msg":"ok"}`))
+
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if f.key == "" || !strings.Contains(r.Header.Get("Cookie"), "main[UTMPKEY]="+f.key) {
+			w.Write([]byte("<html><body>您未登录,请登录后继续操作</body></html>"))
+			return
+		}
+		w.Write([]byte("<html><body>board</body></html>"))
+	}
+}
+
+func TestNForumSession(t *testing.T) {
+	f := &fakeNForum{}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	var cfg config.CommonConfig
+	cfg.Retry.MaxAttempts = 1
+	ctx := basic.WithSession(context.Background(), nforumSession(ts.URL, "alice", "secret"))
+	client := basic.NewHTTPClient(ctx, cfg, basic.NewResult())
+
+	get := func() string {
+		res, err := client.Get(ts.URL + "/nForum/board/HouseRent?ajax")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return string(body)
+	}
+
+	for k, expire := range []bool{false, false, true, false} {
+		if expire {
+			f.expire()
+		}
+		if body := get(); !strings.Contains(body, "board") {
+			t.Errorf("page #%d == %q, want board", k+1, body)
+		}
+	}
+
+	// logged in before the first page, and again once the session expired
+	if f.logins != 2 {
+		t.Errorf("logins == %d, want 2", f.logins)
+	}
+
+	// failed login fails requests
+	ctx = basic.WithSession(context.Background(), nforumSession(ts.URL, "alice", "wrong"))
+	client = basic.NewHTTPClient(ctx, cfg, basic.NewResult())
+	if _, err := client.Get(ts.URL + "/nForum/board/HouseRent?ajax"); err == nil {
+		t.Error("request with failed login should fail")
+	}
+}
@@ -1,30 +1,26 @@
 package rent
 
 import (
-	"bytes"
 	"context"
-	"errors"
+	"fmt"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/viper"
-	"github.com/valyala/fasthttp"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/asciimoo/colly"
 	"github.com/deckarep/golang-set"
-	"github.com/gocarina/gocsv"
 	"github.com/jinzhu/now"
 
+	"github.com/shohi/goinsight/basic"
 	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
 	"github.com/shohi/goinsight/util"
-	"go.uber.org/zap"
-
-	"github.com/tealeg/xlsx"
 )
 
 // SmthData ...
@@ -33,7 +29,14 @@ type SmthData struct {
 	Href     string    `csv:"href"`
 	Author   string    `csv:"author"`
 	Comments int       `csv:"comments"`
-	Last     time.Time `csv:"time"`
+	Last     time.Time `csv:"last"`
+	// new, or why a listing seen before is new again, e.g. expired
+	Status string `csv:"status"`
+}
+
+// hash - hash of link of the listing, telling whether it changed
+func (d *SmthData) hash() string {
+	return store.Hash([]interface{}{d.Href})
 }
 
 // const baseURL = "http://www.newsmth.net/nForum/board/HouseRent?ajax"
@@ -82,24 +85,29 @@ func (d *SmthData) populate(s *goquery.Selection, domainURL string) {
 	d.Last, err = parseTime(lasttime)
 }
 
-var logger = zap.NewExample().Sugar()
+var logger = util.NewLogger().Sugar()
+
+func init() {
+	basic.Register("rent-smth", func(v *viper.Viper, seen store.SeenStore) (basic.Insighter, error) {
+		return NewSmthRentInsighter(v, seen)
+	})
+}
 
-// NewSmthRentInsighter -- create new SmthRentInsighter using configuration
-func NewSmthRentInsighter(v *viper.Viper) *SmthRentInsighter {
+// NewSmthRentInsighter -- create new SmthRentInsighter using configuration,
+// collected listings are remembered in seen
+func NewSmthRentInsighter(v *viper.Viper, seen store.SeenStore) (*SmthRentInsighter, error) {
 	var cfg config.SmthRentConfig
 
 	// unmarshal direct fields
 	err := v.Unmarshal(&cfg)
 	if err != nil {
-		logger.Info(err)
-		return nil
+		return nil, err
 	}
 
 	// unmarshal component
 	err = v.Unmarshal(&cfg.CommonConfig)
 	if err != nil {
-		logger.Info(err)
-		return nil
+		return nil, err
 	}
 
 	//
@@ -117,147 +125,127 @@ func NewSmthRentInsighter(v *viper.Viper) *SmthRentInsighter {
 		}
 	}
 
-	logger.Info(cfg)
-	return &SmthRentInsighter{
+	s := &SmthRentInsighter{
 		Config:        cfg,
 		authorSet:     mapset.NewSet(),
 		bannedAuthors: bannedAuthors,
 		bannedTitles:  bannedTitles,
+		seen:          seen,
+	}
+	if _, _, err = s.credentials(); err != nil {
+		return nil, err
 	}
+
+	logger.Info(cfg)
+	return s, nil
 }
 
 // SmthRentInsighter ...
 type SmthRentInsighter struct {
 	Config config.SmthRentConfig
 
-	pageURLs  []string
 	authorSet mapset.Set
-	client    fasthttp.Client
 
 	bannedAuthors mapset.Set
 	bannedTitles  mapset.Set
+
+	seen store.SeenStore
 }
 
 // Insight - insight smth rent
-func (s *SmthRentInsighter) Insight(ctx context.Context) {
+func (s *SmthRentInsighter) Insight(ctx context.Context) (*basic.Result, error) {
 	defer logger.Sync()
 
 	//
+	result := basic.NewResult()
 	var dataList []*SmthData
+	var mu sync.Mutex
 
-	// Instantiate default collector
-	c := colly.NewCollector()
+	var u, _ = url.Parse(s.Config.URL)
+	var domainURL = u.Scheme + "://" + u.Host
 
-	// Cache responses to prevent multiple download of pages
-	// even if the collector is restarted
-	c.CacheDir = s.Config.CacheDir
+	// Log in if account is set, session is kept by all requests bound to ctx
+	user, password, err := s.credentials()
+	if err != nil {
+		return result, err
+	}
+	if user != "" {
+		ctx = basic.WithSession(ctx, nforumSession(domainURL, user, password))
+	}
+
+	// Instantiate collector bound to ctx
+	c := basic.NewCollector(ctx, s.Config.CommonConfig, result)
 
 	if s.Config.NewCache {
 		os.RemoveAll(c.CacheDir)
 	}
 
-	//
-	err := s.getPageURLs()
-	if err != nil || len(s.pageURLs) == 0 {
-		logger.Infow("fail to get page list", "pageURLs", len(s.pageURLs), "error", err)
-		return
-	}
-
-	var u, _ = url.Parse(s.Config.URL)
-	var domainURL = u.Scheme + "://" + u.Host
-
 	// OnHTML must be set before Visit
 	// Parse html to get info
 	c.OnHTML("#main #body .b-content table tbody tr:not(.ad)", func(e *colly.HTMLElement) {
-		txn := config.DB.NewTransaction(true)
-		defer txn.Discard()
-
 		data := &SmthData{}
 		data.populate(e.DOM, domainURL)
+		result.AddParsed()
 
 		if !s.isValid(data) {
+			result.AddFiltered()
 			return
 		}
 
-		// Check whether or not in database
+		// Check whether or not in database, new items are marked seen
 		key := data.Title + "_" + data.Author
-		item, err := txn.Get([]byte(key))
-		if err == nil {
-			_, e := item.Value()
-			if e == nil {
-				return
-			}
+		state, err := s.seen.MarkWithMeta(key, store.Meta{Source: data.Href, Hash: data.hash()})
+		if err != nil {
+			result.AddError(basic.ErrDB)
+			logger.Info(err.Error())
+		}
+		if !state.IsNew() {
+			result.AddDuplicate()
+			return
 		}
+		data.Status = string(state)
 
 		// add data to datalist
+		result.AddNew()
+		mu.Lock()
 		dataList = append(dataList, data)
-		err = txn.Set([]byte(key), []byte("0"), byte(0))
-		if err != nil {
-			logger.Info(err.Error())
-		}
+		mu.Unlock()
 	})
 
 	// Start scrapping
-	for _, url := range s.pageURLs {
-		go func(u string) {
-			c.Visit(u)
-		}(url)
+	p := s.paginator()
+	p.Client = basic.NewHTTPClient(ctx, s.Config.CommonConfig, result)
+	err = p.Visit(ctx, c, s.Config.PageConcurrency())
+	if err != nil && ctx.Err() == nil {
+		logger.Infow("fail to get page list", "error", err)
+		result.AddError(basic.ErrNetwork)
+		return result, fmt.Errorf("fail to get page list: %v", err)
 	}
-	c.Wait()
 
 	// Output result
 	if len(dataList) == 0 {
 		logger.Info("final rent data is empty")
-		return
+		return result, ctx.Err()
 	}
 
 	if s.Config.NewDownload {
 		os.RemoveAll(s.Config.DownloadDir)
 	}
 
-	filename := filepath.Join(s.Config.DownloadDir, "smth_"+time.Now().Format("20060102150405"))
-	logger.Infow("fetching completed", "total_number", len(dataList), "filename", filename)
-	// err = s.outputCSV(filename, dataList)
-	s.outputXLSX(filename, dataList)
-
-	if err != nil {
-		logger.Infow("output result error", "error", err)
+	logger.Infow("fetching completed", "total_number", len(dataList))
+	if err = basic.WriteOutputs(s.Config.CommonConfig, "smth_", dataList, result); err != nil {
+		return result, err
 	}
-}
-
-func (s *SmthRentInsighter) getPageURLs() error {
-	homePage := s.Config.URL + "&p=1"
-	statusCode, body, err := s.client.Get(nil, homePage)
 
-	logger.Infow("", "home_page", homePage)
-
-	if err != nil {
-		return err
-	}
-
-	if statusCode != fasthttp.StatusOK {
-		return errors.New("Status Code Is Not OK")
-	}
-
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-
-	numStr := doc.Find("#body div.t-pre ul.pagination ol.page-main li:nth-last-child(2) a").Text()
-	num, err := strconv.Atoi(numStr)
-	if err != nil {
-		return err
-	}
-
-	if num > 0 {
-		for k := 0; k < num; k++ {
-			requestURL := s.Config.URL + "&p=" + strconv.Itoa(k+1)
-			s.pageURLs = append(s.pageURLs, requestURL)
-		}
-	}
+	return result, ctx.Err()
+}
 
-	return nil
+// paginator - listing pages, settings in `Pagination` table override the defaults
+func (s *SmthRentInsighter) paginator() *basic.Paginator {
+	return basic.NewPaginator(s.Config.URL, s.Config.Pagination, config.PaginationConfig{
+		PageParam:     "p",
+		CountSelector: "#body div.t-pre ul.pagination ol.page-main li:nth-last-child(2) a",
+	})
 }
 
 func (s *SmthRentInsighter) isValid(data *SmthData) (v bool) {
@@ -291,59 +279,3 @@ func (s *SmthRentInsighter) isValid(data *SmthData) (v bool) {
 
 	return
 }
-
-func (s *SmthRentInsighter) outputCSV(filename string, dataList []*SmthData) error {
-	fp := filename + ".csv"
-	file, err := util.CreateFile(fp)
-	if err != nil {
-		return err
-	}
-	return gocsv.MarshalFile(&dataList, file)
-}
-
-func (s *SmthRentInsighter) outputXLSX(filename string, dataList []*SmthData) error {
-	var err error
-	fp := filename + ".xlsx"
-
-	baseDir := filepath.Dir(fp)
-	if exists, err := util.Exists(baseDir); !exists || (err != nil) {
-		err = os.MkdirAll(baseDir, os.ModePerm)
-		if err != nil {
-			logger.Errorw("create base dir for saving result err", "error_msg", err, "base_dir", baseDir)
-			return err
-		}
-	}
-
-	file := xlsx.NewFile()
-	sheet, err := file.AddSheet("Sheet1")
-	if err != nil {
-		logger.Infow("create sheet error", "info", err)
-		return err
-	}
-
-	headerRow := sheet.AddRow()
-	headerRow.AddCell().SetValue("title")
-	headerRow.AddCell().SetValue("href")
-	headerRow.AddCell().SetValue("author")
-	headerRow.AddCell().SetValue("comments")
-	headerRow.AddCell().SetValue("last")
-
-	for _, data := range dataList {
-		row := sheet.AddRow()
-
-		//
-		row.AddCell().SetValue(data.Title)
-		row.AddCell().SetValue(data.Href)
-		row.AddCell().SetValue(data.Author)
-		row.AddCell().SetValue(data.Comments)
-		row.AddCell().SetDateTime(data.Last)
-	}
-
-	err = file.Save(fp)
-
-	if err != nil {
-		logger.Infow("save result to xlsx error", "error_msg", err)
-	}
-
-	return err
-}
@@ -1,6 +1,7 @@
 package rent
 
 import (
+	"context"
 	"log"
 	"testing"
 
@@ -13,7 +14,10 @@ func testGetPageURLs(t *testing.T) {
 	cfg.URL = "http://www.newsmth.net/nForum/board/HouseRent?ajax"
 
 	var s = &SmthRentInsighter{Config: cfg}
-	log.Println(s.getPageURLs())
-	log.Println(len(s.pageURLs))
-	log.Println(s.pageURLs[0])
+	urls, err := s.paginator().Pages(context.Background())
+	log.Println(err)
+	log.Println(len(urls))
+	if len(urls) > 0 {
+		log.Println(urls[0])
+	}
 }
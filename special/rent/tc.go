@@ -1,36 +1,45 @@
 package rent
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/asciimoo/colly"
 	"github.com/deckarep/golang-set"
+	"github.com/shohi/goinsight/basic"
 	"github.com/shohi/goinsight/config"
-	"github.com/shohi/goinsight/util"
+	"github.com/shohi/goinsight/store"
 	"github.com/spf13/viper"
-	"github.com/tealeg/xlsx"
-	"github.com/valyala/fasthttp"
 )
 
 // TcData ...
 type TcData struct {
-	Title    string    `csv:"title"`
-	Rental   float64   `csv:"rental"`
-	Room     string    `csv:"Room"`
-	District string    `csv:"district"`
-	Address  string    `csv:"address"`
-	Href     string    `csv:"href"`
-	Landlord string    `csv:"landlord"`
-	Last     time.Time `csv:"last"`
+	Title  string  `csv:"title"`
+	Rental float64 `csv:"rental"`
+	// rental before the current one, zero if it never changed
+	PreviousRental float64   `csv:"previous_rental"`
+	Room           string    `csv:"room"`
+	District       string    `csv:"district"`
+	Address        string    `csv:"address"`
+	Href           string    `csv:"href"`
+	Landlord       string    `csv:"landlord"`
+	Last           time.Time `csv:"last"`
+	// new, or why a listing seen before is new again, e.g. expired
+	Status string `csv:"status"`
+}
+
+// hash - hash of rental, room and address of the listing, telling whether it changed
+func (d *TcData) hash() string {
+	return store.Hash([]interface{}{d.Rental, d.Room, d.District, d.Address, d.Landlord})
 }
 
 func (d *TcData) populate(s *goquery.Selection) (err error) {
@@ -62,28 +71,35 @@ func (d *TcData) populate(s *goquery.Selection) (err error) {
 	d.Room = strings.Trim(s.Find("p.room").Text(), " ")
 	d.Landlord = strings.Trim(s.Find(".des .geren").Text(), " ")
 	d.Address = strings.Trim(s.Find(".des p.add").Text(), " ")
-	d.District = strings.Fields(d.Address)[0]
+	if fields := strings.Fields(d.Address); len(fields) > 0 {
+		d.District = fields[0]
+	}
 
 	d.Rental, err = strconv.ParseFloat(s.Find(".listliright .money b").Text(), 64)
 	return
 }
 
-// NewTcRentInsighter -- create new TcRentInsighter using configuration
-func NewTcRentInsighter(v *viper.Viper) *TcRentInsighter {
+func init() {
+	basic.Register("rent-tc", func(v *viper.Viper, seen store.SeenStore) (basic.Insighter, error) {
+		return NewTcRentInsighter(v, seen)
+	})
+}
+
+// NewTcRentInsighter -- create new TcRentInsighter using configuration,
+// collected listings are remembered in seen
+func NewTcRentInsighter(v *viper.Viper, seen store.SeenStore) (*TcRentInsighter, error) {
 	var cfg config.TcRentConfig
 
 	// unmarshal direct fields
 	err := v.Unmarshal(&cfg)
 	if err != nil {
-		logger.Info(err)
-		return nil
+		return nil, err
 	}
 
 	// unmarshal component
 	err = v.Unmarshal(&cfg.CommonConfig)
 	if err != nil {
-		logger.Info(err)
-		return nil
+		return nil, err
 	}
 
 	//
@@ -106,148 +122,138 @@ func NewTcRentInsighter(v *viper.Viper) *TcRentInsighter {
 		Config:           cfg,
 		allowedDistricts: allowedDistricts,
 		bannedRooms:      bannedRooms,
-	}
+		seen:             seen,
+	}, nil
 }
 
 // TcRentInsighter ...
 type TcRentInsighter struct {
 	Config config.TcRentConfig
 
-	pageURLs []string
-	client   fasthttp.Client
-
 	allowedDistricts mapset.Set
 	bannedRooms      mapset.Set
-	stopFlag         bool // if response url is different from request's, we need to stop fetching
-}
-
-func (s *TcRentInsighter) getPageURLs() error {
-	homePage := fmt.Sprintf(s.Config.URL, 1)
-
-	statusCode, body, err := s.client.Get(nil, homePage)
-
-	logger.Info("home page", homePage)
-
-	if err != nil {
-		return err
-	}
-
-	if statusCode != fasthttp.StatusOK {
-		return errors.New("Status Code Is Not OK")
-	}
-
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-
-	numStr := doc.Find("#bottom_ad_li a:not(.next, .prv) span").Last().Text()
-	num, err := strconv.Atoi(numStr)
-
-	if err != nil {
-		num = s.Config.DefaultTotalPages
-	}
 
-	for k := 0; k < num; k++ {
-		requestURL := fmt.Sprintf(s.Config.URL, k+1)
-		s.pageURLs = append(s.pageURLs, requestURL)
-	}
+	seen store.SeenStore
+}
 
-	return nil
+// paginator - listing pages, settings in `Pagination` table override the defaults
+func (s *TcRentInsighter) paginator() *basic.Paginator {
+	return basic.NewPaginator(s.Config.URL, s.Config.Pagination, config.PaginationConfig{
+		CountSelector: "#bottom_ad_li a:not(.next, .prv) span",
+		DefaultPages:  s.Config.DefaultTotalPages,
+	})
 }
 
 // Insight - insight 58tongcheng rent
 // implement interface
-func (s *TcRentInsighter) Insight(ctx context.Context) {
+func (s *TcRentInsighter) Insight(ctx context.Context) (*basic.Result, error) {
 	defer logger.Sync()
 
 	//
+	result := basic.NewResult()
 	var dataList []*TcData
+	var mu sync.Mutex
 
-	// Instantiate default collector
-	c := colly.NewCollector()
+	hist, err := newHistory(s.seen)
+	if err != nil {
+		result.AddError(basic.ErrDB)
+		return result, err
+	}
 
-	// Cache responses to prevent multiple download of pages
-	// even if the collector is restarted
-	c.CacheDir = s.Config.CacheDir
+	// the site redirects once pages run out or requests look like a bot's
+	var stopped int32
+	ctx = basic.WithRedirectHook(ctx, func(from, to *url.URL) {
+		logger.Infow("redirected, stop fetching", "from", from.String(), "to", to.String())
+		atomic.StoreInt32(&stopped, 1)
+	})
+
+	// Instantiate collector bound to ctx
+	c := basic.NewCollector(ctx, s.Config.CommonConfig, result)
 
 	if s.Config.NewCache {
 		os.RemoveAll(c.CacheDir)
 	}
 
-	//
-	err := s.getPageURLs()
-	if err != nil || len(s.pageURLs) == 0 {
-		logger.Infow("fail to get page list", "pageURLs", len(s.pageURLs), "error", err)
-		return
-	}
-
 	// OnHTML must be set before Visit
 	// Parse html to get info
 	c.OnHTML(".main .content .listBox .listUl>li[logr][sortid]", func(e *colly.HTMLElement) {
-		txn := config.DB.NewTransaction(true)
-		defer txn.Discard()
-
-		if s.stopFlag {
+		if atomic.LoadInt32(&stopped) != 0 {
 			return
 		}
 
 		data := &TcData{}
-		data.populate(e.DOM)
+		// a listing parsed partly is neither recorded nor output
+		err := data.populate(e.DOM)
+		if err != nil {
+			result.AddError(basic.ErrParse)
+			return
+		}
+		result.AddParsed()
+
+		// every listing found is recorded, also those filtered out, so that
+		// listings seen before tell how they changed and which disappeared
+		var repriced bool
+		if data.PreviousRental, repriced, err = hist.observe(data.Href, data.Title, data.Rental); err != nil {
+			result.AddError(basic.ErrDB)
+			logger.Info(err.Error())
+		}
 
 		if !s.isValid(data) {
+			result.AddFiltered()
 			return
 		}
 
-		// Check whether or not in database
+		// Check whether or not in database, new items are marked seen
 		key := data.Title + "_" + data.Room
-		item, err := txn.Get([]byte(key))
-		if err == nil {
-			_, e := item.Value()
-			if e == nil {
-				return
-			}
-		}
-
-		// add data to datalist
-		dataList = append(dataList, data)
-		err = txn.Set([]byte(key), []byte("0"), byte(0))
+		state, err := s.seen.MarkWithMeta(key, store.Meta{Source: data.Href, Hash: data.hash()})
 		if err != nil {
+			result.AddError(basic.ErrDB)
 			logger.Info(err.Error())
 		}
-	})
-
-	c.OnRequest(func(req *colly.Request) {
-		req.Ctx.Put("OriginURL", req.URL.String())
-	})
-
-	c.OnResponse(func(res *colly.Response) {
-		originURL := res.Ctx.Get("OriginURL")
-		if strings.Compare(res.Request.URL.String(), originURL) != 0 {
-			s.stopFlag = true
+		// listings seen before are output again if their rental changed
+		if !state.IsNew() && !repriced {
+			result.AddDuplicate()
+			return
 		}
+		if data.Status = string(state); !state.IsNew() {
+			data.Status = string(store.StateChanged)
+		}
+
+		// add data to datalist
+		result.AddNew()
+		mu.Lock()
+		dataList = append(dataList, data)
+		mu.Unlock()
 	})
 
 	// Start scrapping
-	for _, url := range s.pageURLs {
-		go func(u string) {
-			c.Visit(u)
-		}(url)
+	p := s.paginator()
+	p.Client = basic.NewHTTPClient(ctx, s.Config.CommonConfig, result)
+	err = p.Visit(ctx, c, s.Config.PageConcurrency())
+	if err != nil && ctx.Err() == nil {
+		logger.Infow("fail to get page list", "error", err)
+		result.AddError(basic.ErrNetwork)
+		return result, fmt.Errorf("fail to get page list: %v", err)
+	}
+
+	// listings missed by a run with failed requests, redirected away or with pages
+	// beyond MaxPages left out aren't taken as disappeared
+	complete := err == nil && ctx.Err() == nil && len(result.Failures) == 0 && atomic.LoadInt32(&stopped) == 0 && !p.Capped()
+	if err := hist.report(s.Config.CommonConfig, "tc_", complete, result); err != nil {
+		logger.Infow("report listing changes error", "error", err)
 	}
-	c.Wait()
 
 	// Output result
 	if len(dataList) == 0 {
 		logger.Info("final rent data is empty")
-		return
+		return result, ctx.Err()
 	}
 
-	filename := filepath.Join(s.Config.DownloadDir, "tc_"+time.Now().Format("20060102150405"))
-	s.outputXLSX(filename, dataList)
-
-	if err != nil {
-		logger.Infow("output result error", "error", err)
+	if err = basic.WriteOutputs(s.Config.CommonConfig, "tc_", dataList, result); err != nil {
+		return result, err
 	}
+
+	return result, ctx.Err()
 }
 
 func (s *TcRentInsighter) isValid(d *TcData) (v bool) {
@@ -273,51 +279,3 @@ func (s *TcRentInsighter) isValid(d *TcData) (v bool) {
 
 	return
 }
-
-func (s *TcRentInsighter) outputXLSX(filename string, dataList []*TcData) error {
-	var err error
-	fp := filename + ".xlsx"
-
-	baseDir := filepath.Dir(fp)
-	if exists, err := util.Exists(baseDir); !exists || (err != nil) {
-		err = os.MkdirAll(baseDir, os.ModePerm)
-		if err != nil {
-			logger.Errorw("create base dir for saving result err", "error_msg", err, "base_dir", baseDir)
-			return err
-		}
-	}
-
-	file := xlsx.NewFile()
-	sheet, err := file.AddSheet("Sheet1")
-	if err != nil {
-		logger.Infow("create sheet error", "info", err)
-		return err
-	}
-
-	headRow := sheet.AddRow()
-	headRow.AddCell().SetValue("title")
-	headRow.AddCell().SetValue("rental")
-	headRow.AddCell().SetValue("room")
-	headRow.AddCell().SetValue("district")
-	headRow.AddCell().SetValue("address")
-	headRow.AddCell().SetValue("href")
-	headRow.AddCell().SetValue("landlord")
-	headRow.AddCell().SetValue("last")
-
-	for _, data := range dataList {
-		row := sheet.AddRow()
-		//
-		row.AddCell().SetValue(data.Title)
-		row.AddCell().SetValue(data.Rental)
-		row.AddCell().SetValue(data.Room)
-		row.AddCell().SetValue(data.District)
-		row.AddCell().SetValue(data.Address)
-		row.AddCell().SetValue(data.Href)
-		row.AddCell().SetValue(data.Landlord)
-		row.AddCell().SetDateTime(data.Last)
-	}
-
-	err = file.Save(fp)
-
-	return err
-}
@@ -1,10 +1,22 @@
 package rent
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/deckarep/golang-set"
 	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/store"
 )
 
 func testGetPages(t *testing.T) {
@@ -12,7 +24,166 @@ func testGetPages(t *testing.T) {
 	cfg.URL = "http://bj.58.com/chaoyang/hezu/0/pn%d/?minprice=1800_4000"
 
 	var s = &TcRentInsighter{Config: cfg}
-	log.Println(s.getPageURLs())
-	log.Println(len(s.pageURLs))
-	log.Println(s.pageURLs[0])
+	urls, err := s.paginator().Pages(context.Background())
+	log.Println(err)
+	log.Println(len(urls))
+	if len(urls) > 0 {
+		log.Println(urls[0])
+	}
+}
+
+// tcListing - listing of test site
+type tcListing struct {
+	id string
+	// zero if it is to negotiate
+	rental int
+	posted time.Time
+}
+
+// tcSite - test site listing pages of tc, pages of listings are set between runs
+type tcSite struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	pages [][]tcListing
+	// page number redirected to a verification page
+	blocked int
+}
+
+func newTcSite() *tcSite {
+	site := &tcSite{}
+	site.Server = httptest.NewServer(http.HandlerFunc(site.serve))
+	return site
+}
+
+func (site *tcSite) set(blocked int, pages ...[]tcListing) {
+	site.mu.Lock()
+	site.pages, site.blocked = pages, blocked
+	site.mu.Unlock()
+}
+
+func (site *tcSite) serve(w http.ResponseWriter, r *http.Request) {
+	site.mu.Lock()
+	defer site.mu.Unlock()
+
+	var n int
+	if _, err := fmt.Sscanf(r.URL.Path, "/pn%d/", &n); err != nil || n < 1 || n > len(site.pages) {
+		fmt.Fprint(w, "<html><body>verify you are human</body></html>")
+		return
+	}
+	if n == site.blocked {
+		http.Redirect(w, r, "/verify", http.StatusFound)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(`<html><body><div class="main"><div class="content"><div class="listBox"><ul class="listUl">`)
+	for _, l := range site.pages[n-1] {
+		// rental left to negotiate can't be parsed
+		money := "面议"
+		if l.rental > 0 {
+			money = fmt.Sprint(l.rental)
+		}
+		fmt.Fprintf(&b, `<li logr="1" sortid="%d"><div class="des"><a href="/zufang/%s.shtml?psid=%d">%s</a>`+
+			`<p class="room">1室</p><p class="add">朝阳 团结湖</p></div>`+
+			`<div class="listliright"><div class="money"><b>%s</b></div></div></li>`,
+			l.posted.UnixNano()/int64(time.Millisecond), l.id, n, l.id, money)
+	}
+	b.WriteString(`</ul></div></div></div><div id="bottom_ad_li">`)
+	for k := range site.pages {
+		fmt.Fprintf(&b, `<a href="/pn%d/"><span>%d</span></a>`, k+1, k+1)
+	}
+	b.WriteString(`</div></body></html>`)
+	fmt.Fprint(w, b.String())
+}
+
+// runTc - run tc insighter on site with seen, returns changes written by the run
+func runTc(t *testing.T, site *tcSite, seen store.SeenStore, maxPages int) string {
+	dir, err := ioutil.TempDir("", "rent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.TcRentConfig{}
+	cfg.URL = site.URL + "/pn%d/"
+	cfg.DownloadDir = dir
+	cfg.Outputs = []string{"csv"}
+	cfg.Pagination.MaxPages = maxPages
+
+	s := &TcRentInsighter{Config: cfg, allowedDistricts: mapset.NewSet(), bannedRooms: mapset.NewSet(), seen: seen}
+	if _, err := s.Insight(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "tc_*.csv"))
+	var out []string
+	for _, fp := range files {
+		data, _ := ioutil.ReadFile(fp)
+		out = append(out, filepath.Base(fp)+"\n"+string(data))
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestTcHistory(t *testing.T) {
+	site := newTcSite()
+	defer site.Close()
+	seen := store.NewMemory()
+
+	now := time.Now()
+	a, b := tcListing{"a", 3000, now}, tcListing{"b", 4000, now}
+	site.set(0, []tcListing{a}, []tcListing{b})
+	runTc(t, site, seen, 0)
+
+	// a listing posted long ago is still online, b is cheaper
+	old := tcListing{"a", 3000, now.AddDate(0, 0, -20)}
+	cheaper := tcListing{"b", 3500, now}
+	site.set(0, []tcListing{old}, []tcListing{cheaper})
+	out := runTc(t, site, seen, 0)
+	if strings.Contains(out, ChangeGone) {
+		t.Errorf("listing too old to be output is reported disappeared:\n%s", out)
+	}
+	if !strings.Contains(out, ChangePriceDrop) {
+		t.Errorf("price drop isn't reported:\n%s", out)
+	}
+	// b is output again as its rental changed, with the previous one
+	if !strings.Contains(out, "b,3500,4000,1室") || !strings.Contains(out, ",changed") {
+		t.Errorf("repriced listing isn't output with previous rental:\n%s", out)
+	}
+
+	// a page redirected away, or left out by MaxPages, doesn't tell b disappeared
+	site.set(2, []tcListing{old}, []tcListing{cheaper})
+	if out := runTc(t, site, seen, 0); strings.Contains(out, ChangeGone) {
+		t.Errorf("listing of a redirected page is reported disappeared:\n%s", out)
+	}
+	site.set(0, []tcListing{old}, []tcListing{cheaper})
+	runTc(t, site, seen, 0)
+	if out := runTc(t, site, seen, 1); strings.Contains(out, ChangeGone) {
+		t.Errorf("listing of a page beyond MaxPages is reported disappeared:\n%s", out)
+	}
+
+	// b is gone from a complete run
+	site.set(0, []tcListing{old})
+	if out := runTc(t, site, seen, 0); !strings.Contains(out, ChangeGone) {
+		t.Errorf("disappeared listing isn't reported:\n%s", out)
+	}
+}
+
+func TestTcPartlyParsed(t *testing.T) {
+	site := newTcSite()
+	defer site.Close()
+	seen := store.NewMemory()
+
+	site.set(0, []tcListing{{"a", 3000, time.Now()}, {"c", 0, time.Now()}})
+	runTc(t, site, seen, 0)
+
+	if ok, _ := seen.Has("a_1室"); !ok {
+		t.Error("listing parsed should be seen")
+	}
+	if ok, _ := seen.Has("c_1室"); ok {
+		t.Error("listing parsed partly should not be seen")
+	}
+	if r, _ := store.Namespace(seen, historyNamespace).Get(site.URL + "/zufang/c.shtml"); r != nil {
+		t.Errorf("listing parsed partly is recorded in history: %+v", r)
+	}
 }
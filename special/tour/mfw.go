@@ -1,61 +1,64 @@
 package tour
 
 import (
-	"bytes"
 	"context"
-	"errors"
-	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sync"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/asciimoo/colly"
+	"github.com/shohi/goinsight/basic"
 	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/media"
+	"github.com/shohi/goinsight/store"
 	"github.com/shohi/goinsight/util"
 	"github.com/spf13/viper"
-	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 )
 
-var logger = zap.NewExample().Sugar()
+var logger = util.NewLogger().Sugar()
 
 // MfwTourInsighter ...
 type MfwTourInsighter struct {
 	Config config.MfwImageConfig
 
-	pageURLs []string
-	client   fasthttp.Client
+	seen store.SeenStore
 }
 
-// NewMfwTourInsighter -- create new MfwTourInsighter using configuration
-func NewMfwTourInsighter(v *viper.Viper) *MfwTourInsighter {
+func init() {
+	basic.Register("tour-mfw", func(v *viper.Viper, seen store.SeenStore) (basic.Insighter, error) {
+		return NewMfwTourInsighter(v, seen)
+	})
+}
+
+// NewMfwTourInsighter -- create new MfwTourInsighter using configuration,
+// fetched notes are remembered in seen
+func NewMfwTourInsighter(v *viper.Viper, seen store.SeenStore) (*MfwTourInsighter, error) {
 	var cfg config.MfwImageConfig
 
 	err := v.Unmarshal(&cfg.CommonConfig)
 	if err != nil {
-		logger.Info(err)
-		return nil
+		return nil, err
 	}
 
 	logger.Info(cfg)
-	return &MfwTourInsighter{Config: cfg}
+	return &MfwTourInsighter{Config: cfg, seen: seen}, nil
 }
 
 // Insight - insight image, ref http://blog.csdn.net/qijingpei/article/details/77668972
 // Implement interface
-func (s *MfwTourInsighter) Insight(ctx context.Context) {
+func (s *MfwTourInsighter) Insight(ctx context.Context) (*basic.Result, error) {
 	defer logger.Sync()
 
-	// Instantiate default collector
-	c := colly.NewCollector()
-	detailCollector := colly.NewCollector()
+	result := basic.NewResult()
 
-	// Cache responses to prevent multiple download of pages
-	// even if the collector is restarted
-	c.CacheDir = s.Config.CacheDir
-	detailCollector.CacheDir = s.Config.CacheDir
+	// Instantiate collectors bound to ctx
+	c := basic.NewCollector(ctx, s.Config.CommonConfig, result)
+	detailCollector := basic.NewCollector(ctx, s.Config.CommonConfig, result)
+	client := basic.NewHTTPClient(ctx, s.Config.CommonConfig, result)
+	downloader := basic.NewDownloader(ctx, s.Config.CommonConfig, client, result)
+	defer downloader.Wait()
 
 	if s.Config.NewCache {
 		os.RemoveAll(c.CacheDir)
@@ -65,40 +68,59 @@ func (s *MfwTourInsighter) Insight(ctx context.Context) {
 		os.RemoveAll(s.Config.DownloadDir)
 	}
 
-	// 1. Get URLs
-	if err := s.getPageURLs(); err != nil {
-		logger.Infow("get total pages error", "error", err)
-		return
-	}
-	logger.Infow("total pages", "count", len(s.pageURLs))
+	// notes being visited by detail link, whose images are being queued
+	var notesMu sync.Mutex
+	notes := make(map[string]*noteDownloads)
 
 	// OnHTML must be set before Visit. On each page list
 	c.OnHTML("div.post-list li div.post-cover a", func(e *colly.HTMLElement) {
-		txn := config.DB.NewTransaction(true)
-		defer txn.Discard()
-
 		link := e.Attr("href")
 		logger.Infow("", zap.String("link", link))
+		result.AddParsed()
+
 		// Check whether or not in database
-		item, err := txn.Get([]byte(link))
-		if err == nil {
-			_, e := item.Value()
-			if e == nil {
-				return
-			}
+		seen, err := s.seen.Has(link)
+		if err != nil {
+			result.AddError(basic.ErrDB)
+			logger.Info(err.Error())
+			return
+		}
+		if seen {
+			result.AddDuplicate()
+			return
 		}
 		logger.Infow("", zap.String("link", link))
 		u, err := url.Parse(e.Request.URL.String())
 		detailLink := u.Scheme + "://" + u.Host + link
 
+		// the note is marked seen once all of its images are downloaded,
+		// otherwise it is left for the next run
+		note := newNoteDownloads(func() {
+			if _, err := s.seen.MarkWithMeta(link, store.Meta{Source: detailLink}); err != nil {
+				result.AddError(basic.ErrDB)
+				logger.Info(err.Error())
+			}
+		})
+		notesMu.Lock()
+		notes[detailLink] = note
+		notesMu.Unlock()
+
 		err = detailCollector.Visit(detailLink)
-		if err != nil {
-			logger.Infow("detail fetching error", "error", err)
+
+		notesMu.Lock()
+		delete(notes, detailLink)
+		notesMu.Unlock()
+
+		// not fetched fully due to cancellation, leave it for next run
+		if err == nil {
+			err = ctx.Err()
 		}
-		err = txn.Set([]byte(link), []byte("0"), byte(0))
 		if err != nil {
-			logger.Info(err.Error())
+			logger.Infow("detail fetching error", "error", err)
+		} else {
+			result.AddNew()
 		}
+		note.done(err)
 	})
 
 	// on each page, fetch images
@@ -124,13 +146,29 @@ func (s *MfwTourInsighter) Insight(ctx context.Context) {
 			return
 		}
 
-		fp := filepath.Join(s.Config.DownloadDir, baseDir, filename+suffix)
-		err = util.Download(link, fp, false)
-		if err != nil {
-			logger.Infow("failed to download image",
-				"url", e.Request.URL.String(),
-				"error", err.Error(),
-			)
+		notesMu.Lock()
+		note := notes[e.Request.URL.String()]
+		notesMu.Unlock()
+		if note == nil || ctx.Err() != nil {
+			return
+		}
+
+		// suffix is detected from the download if link has none
+		note.add()
+		queued := downloader.Enqueue(&basic.Download{
+			URL:  link,
+			Base: filepath.Join(s.Config.DownloadDir, baseDir, filename),
+			Ext:  suffix,
+			Source: media.Source{
+				Page: e.Request.URL.String(),
+				ID:   baseDir,
+			},
+			Done: func(fp string, n int64, err error) {
+				note.done(err)
+			},
+		})
+		if !queued {
+			note.done(context.Canceled)
 		}
 	})
 
@@ -146,45 +184,56 @@ func (s *MfwTourInsighter) Insight(ctx context.Context) {
 	})
 
 	// Start scrapping
-	for _, url := range s.pageURLs {
-		go func(u string) {
-			logger.Info(u)
-			c.Visit(u)
-		}(url)
+	p := s.paginator()
+	p.Client = client
+	if err := p.Visit(ctx, c, s.Config.PageConcurrency()); err != nil && ctx.Err() == nil {
+		logger.Infow("get total pages error", "error", err)
+		result.AddError(basic.ErrNetwork)
+		return result, err
 	}
-	c.Wait()
-}
+	downloader.Wait()
 
-func (s *MfwTourInsighter) getPageURLs() error {
-	homePage := fmt.Sprintf(s.Config.URL, 1)
+	return result, ctx.Err()
+}
 
-	statusCode, body, err := s.client.Get(nil, homePage)
-	logger.Infow("", "home_page", homePage)
-	if err != nil {
-		return err
-	}
+// noteDownloads - images of a note being downloaded, the note is done once
+// it is visited and all of its images are downloaded
+type noteDownloads struct {
+	mu      sync.Mutex
+	pending int // images queued, plus the visit of the note
+	failed  bool
+	onDone  func()
+}
 
-	if statusCode != fasthttp.StatusOK {
-		return errors.New("Status Code Is Not OK")
-	}
+// newNoteDownloads - note being visited, onDone is called once it and all of its
+// images succeed
+func newNoteDownloads(onDone func()) *noteDownloads {
+	return &noteDownloads{pending: 1, onDone: onDone}
+}
 
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
+// add - image queued
+func (n *noteDownloads) add() {
+	n.mu.Lock()
+	n.pending++
+	n.mu.Unlock()
+}
 
-	numStr := doc.Find("div._pagebar div span.count span").First().Text()
-	num, err := strconv.Atoi(numStr)
-	if err != nil {
-		return err
-	}
+// done - visit or download of an image ended with err
+func (n *noteDownloads) done(err error) {
+	n.mu.Lock()
+	n.pending--
+	n.failed = n.failed || err != nil
+	succeeded := n.pending == 0 && !n.failed
+	n.mu.Unlock()
 
-	if num > 0 {
-		for k := 0; k < num; k++ {
-			requestURL := fmt.Sprintf(s.Config.URL, k+1)
-			s.pageURLs = append(s.pageURLs, requestURL)
-		}
+	if succeeded {
+		n.onDone()
 	}
+}
 
-	return nil
+// paginator - listing pages, settings in `Pagination` table override the defaults
+func (s *MfwTourInsighter) paginator() *basic.Paginator {
+	return basic.NewPaginator(s.Config.URL, s.Config.Pagination, config.PaginationConfig{
+		CountSelector: "div._pagebar div span.count span",
+	})
 }
@@ -1,17 +1,86 @@
 package tour
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/shohi/goinsight/config"
+	"github.com/shohi/goinsight/media"
+	"github.com/shohi/goinsight/store"
 )
 
 func TestGetPages(t *testing.T) {
-	cfg := config.CommonConfig{}
+	cfg := config.MfwImageConfig{}
 	cfg.URL = "http://www.mafengwo.cn/yj/10176/1-0-%d.html"
 
 	s := &MfwTourInsighter{Config: cfg}
-	log.Println(s.getPageURLs())
-	log.Println(len(s.pageURLs))
+	urls, err := s.paginator().Pages(context.Background())
+	log.Println(err)
+	log.Println(len(urls))
+}
+
+func TestNoteMarkedAfterDownloads(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list-1.html":
+			fmt.Fprint(w, `<div class="post-list"><ul>`+
+				`<li><div class="post-cover"><a href="/i/1.html"></a></div></li>`+
+				`<li><div class="post-cover"><a href="/i/2.html"></a></div></li>`+
+				`</ul></div><div class="_pagebar"><div><span class="count"><span>1</span></span></div></div>`)
+		case "/i/1.html", "/i/2.html":
+			fmt.Fprintf(w, `<div class="vc_article"><div class="_j_content_box"><div class="add_pic">`+
+				`<a href="/photo/%s"><img data-rt-src="%s/img/%s.jpg"></a></div></div></div>`,
+				r.URL.Path[3:4], ts.URL, r.URL.Path[3:4])
+		case "/img/1.jpg":
+			fmt.Fprint(w, "jpeg")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "tour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.MfwImageConfig{}
+	cfg.URL = ts.URL + "/list-%d.html"
+	cfg.DownloadDir = dir
+	cfg.Retry.MaxAttempts = 1
+	cfg.PostProcess.Enabled = true
+
+	seen := store.NewMemory()
+	s := &MfwTourInsighter{Config: cfg, seen: seen}
+	if _, err := s.Insight(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// image of note 2 failed, so it is left for the next run
+	if ok, _ := seen.Has("/i/1.html"); !ok {
+		t.Error("note with all images downloaded should be seen")
+	}
+	if ok, _ := seen.Has("/i/2.html"); ok {
+		t.Error("note with failed image should not be seen")
+	}
+
+	// images are saved under the note id, named by their photo id
+	if _, err := os.Stat(filepath.Join(dir, "1", "1.jpg")); err != nil {
+		t.Errorf("image of note 1 isn't saved as 1/1.jpg: %v", err)
+	}
+	var mf media.Manifest
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "1", media.ManifestFile))
+	if err := json.Unmarshal(data, &mf); err != nil || len(mf.Files) != 1 || mf.Files[0].ID != "1" {
+		t.Errorf("manifest of note 1 == %s, want image 1.jpg of id 1", data)
+	}
 }
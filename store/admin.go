@@ -0,0 +1,143 @@
+package store
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// Entry - a key and its record, as exported and imported
+type Entry struct {
+	Key    string  `json:"key"`
+	Record *Record `json:"record"`
+}
+
+// Stat - number and estimated size of keys of a namespace
+type Stat struct {
+	Namespace string
+	Keys      int64
+	Bytes     int64
+}
+
+// Stats - stats of every namespace in name order, keys without namespace
+// are counted in the one named ""
+func (b *Badger) Stats() ([]Stat, error) {
+	stats := make(map[string]*Stat)
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			ns, _ := SplitKey(string(it.Item().Key()))
+			s, ok := stats[ns]
+			if !ok {
+				s = &Stat{Namespace: ns}
+				stats[ns] = s
+			}
+			s.Keys++
+			s.Bytes += it.Item().EstimatedSize()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Stat, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Namespace < list[j].Namespace })
+	return list, nil
+}
+
+// Put - write records of entries as they are, replacing those of the same keys
+func (b *Badger) Put(entries []Entry) error {
+	for len(entries) > 0 {
+		batch := entries
+		if len(batch) > migrateBatch {
+			batch = batch[:migrateBatch]
+		}
+		entries = entries[len(batch):]
+
+		err := b.update(func(txn *badger.Txn) error {
+			for _, e := range batch {
+				if err := txn.Set([]byte(e.Key), e.Record.Encode(), 0); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return b.recount()
+}
+
+// Purge - forget keys with prefix last seen before t, any time if t is zero.
+// Returns number of keys removed.
+func (b *Badger) Purge(prefix string, t time.Time) (int, error) {
+	var keys []string
+	err := b.Scan(prefix, func(key string, r *Record) error {
+		if t.IsZero() || r.LastSeen.Before(t) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for done := 0; done < len(keys); {
+		batch := keys[done:]
+		if len(batch) > migrateBatch {
+			batch = batch[:migrateBatch]
+		}
+
+		err := b.update(func(txn *badger.Txn) error {
+			for _, key := range batch {
+				if err := txn.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return done, err
+		}
+		done += len(batch)
+	}
+	return len(keys), b.recount()
+}
+
+// GC - drop older versions of keys and rewrite value log files of which at least
+// discardRatio can be discarded, returns number of files rewritten
+func (b *Badger) GC(discardRatio float64) (int, error) {
+	if err := b.db.PurgeOlderVersions(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		switch err := b.db.RunValueLogGC(discardRatio); err {
+		case nil:
+			n++
+		case badger.ErrNoRewrite:
+			return n, nil
+		default:
+			return n, err
+		}
+	}
+}
+
+// recount - count records in LegacyNamespace, after they are written directly
+func (b *Badger) recount() error {
+	n, err := b.count(LegacyNamespace + Separator)
+	atomic.StoreInt64(&b.legacy, n)
+	return err
+}
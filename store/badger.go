@@ -0,0 +1,323 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// Reserved namespaces
+const (
+	// LegacyNamespace - records of the format before namespaces, whose insighter is
+	// unknown. A record is moved to the namespace of the first insighter marking its key.
+	LegacyNamespace = "_legacy"
+	// MetaNamespace - settings of the store itself
+	MetaNamespace = "_meta"
+)
+
+// SchemaVersion - version of key and value layout of badger store
+const SchemaVersion = "1"
+
+// schemaKey - key holding SchemaVersion of the store
+var schemaKey = []byte(MetaNamespace + Separator + "schema")
+
+// migrateBatch - max number of keys migrated in one transaction
+const migrateBatch = 500
+
+// Badger - SeenStore persisted in badger, records are encoded by Record.Encode
+type Badger struct {
+	db *badger.DB
+	// number of records left in LegacyNamespace
+	legacy int64
+}
+
+// NewBadger - create store on opened db, which is closed by the caller.
+// Records of the format before namespaces are migrated.
+func NewBadger(db *badger.DB) (*Badger, error) {
+	b := &Badger{db: db}
+	if err := b.migrate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// OpenBadger - open badger in dir and valueDir, creating them if missing, see NewBadger.
+// The store should be closed by calling Close.
+func OpenBadger(dir, valueDir string) (*Badger, error) {
+	for _, d := range []string{dir, valueDir} {
+		if err := os.MkdirAll(d, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = valueDir
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewBadger(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// DB - underlying badger
+func (b *Badger) DB() *badger.DB {
+	return b.db
+}
+
+// Close - close underlying badger
+func (b *Badger) Close() error {
+	return b.db.Close()
+}
+
+// Has - whether key is seen
+func (b *Badger) Has(key string) (bool, error) {
+	r, err := b.Get(key)
+	return r != nil, err
+}
+
+// Get - record of key, nil if it isn't seen
+func (b *Badger) Get(key string) (r *Record, err error) {
+	err = b.db.View(func(txn *badger.Txn) error {
+		r, _, err = b.get(txn, key, false)
+		return err
+	})
+	return r, err
+}
+
+// Mark - mark key seen, returns false if it is seen already
+func (b *Badger) Mark(key string) (bool, error) {
+	state, err := b.MarkWithMeta(key, Meta{})
+	return state.IsNew(), err
+}
+
+// MarkWithMeta - mark key seen with meta, returns its state
+func (b *Badger) MarkWithMeta(key string, meta Meta) (state State, err error) {
+	var claimed bool
+	err = b.update(func(txn *badger.Txn) error {
+		r, c, err := b.get(txn, key, true)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if claimed = c; r == nil {
+			r, state = newRecord(meta, now), StateNew
+		} else {
+			state = r.mark(meta, now)
+		}
+		return txn.Set([]byte(key), r.Encode(), 0)
+	})
+
+	if err != nil {
+		return StateSeen, err
+	}
+	if claimed {
+		atomic.AddInt64(&b.legacy, -1)
+	}
+	return state, nil
+}
+
+// Scan - call fn with each key with prefix and its record, in key order,
+// settings in MetaNamespace are left out. fn must not change the store.
+func (b *Badger) Scan(prefix string, fn func(key string, r *Record) error) error {
+	meta := []byte(MetaNamespace + Separator)
+	return b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			item := it.Item()
+			if bytes.HasPrefix(item.Key(), meta) {
+				continue
+			}
+			value, err := item.Value()
+			if err != nil {
+				return err
+			}
+			r, err := DecodeRecord(value)
+			if err != nil {
+				return fmt.Errorf("key %s: %v", item.Key(), err)
+			}
+			if err := fn(string(item.Key()), r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Expire - forget key
+func (b *Badger) Expire(key string) error {
+	return b.update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+// get - record of key, nil if it isn't seen. A key without record is looked up
+// in LegacyNamespace, and the legacy record is moved to key if claim is set,
+// in which case claimed is set.
+func (b *Badger) get(txn *badger.Txn, key string, claim bool) (r *Record, claimed bool, err error) {
+	r, err = getRecord(txn, []byte(key))
+	if r != nil || err != nil || atomic.LoadInt64(&b.legacy) <= 0 {
+		return r, false, err
+	}
+
+	ns, rest := SplitKey(key)
+	if ns == "" {
+		return nil, false, nil
+	}
+
+	legacy := []byte(LegacyNamespace + Separator + rest)
+	r, err = getRecord(txn, legacy)
+	if r == nil || err != nil || !claim {
+		return r, false, err
+	}
+	return r, true, txn.Delete(legacy)
+}
+
+func getRecord(txn *badger.Txn, key []byte) (*Record, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := item.Value()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRecord(value)
+}
+
+// update - run fn in a read-write transaction, again if it conflicts with
+// another one writing the same key at the same time
+func (b *Badger) update(fn func(txn *badger.Txn) error) error {
+	for {
+		err := b.db.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+}
+
+// migrate - move keys of the format before namespaces, whose values are "0" or "1",
+// to LegacyNamespace with their values encoded as records, and set schema version
+func (b *Badger) migrate() error {
+	var version string
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(schemaKey)
+		if err != nil {
+			return err
+		}
+		value, err := item.Value()
+		version = string(value)
+		return err
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+
+	if version == "" {
+		if err := b.migrateLegacy(); err != nil {
+			return err
+		}
+	}
+
+	b.legacy, err = b.count(LegacyNamespace + Separator)
+	return err
+}
+
+func (b *Badger) migrateLegacy() error {
+	type pair struct{ key, value []byte }
+
+	var pairs []pair
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			value, err := item.Value()
+			if err != nil {
+				return err
+			}
+			pairs = append(pairs, pair{
+				key:   append([]byte(nil), item.Key()...),
+				value: append([]byte(nil), value...),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for len(pairs) > 0 {
+		batch := pairs
+		if len(batch) > migrateBatch {
+			batch = batch[:migrateBatch]
+		}
+		pairs = pairs[len(batch):]
+
+		err := b.update(func(txn *badger.Txn) error {
+			for _, p := range batch {
+				r, err := DecodeRecord(p.value)
+				if err != nil {
+					// unknown value, taken as seen
+					r = &Record{Status: StatusSeen}
+				}
+				// time seen is unknown, taken as the time of migration
+				if r.FirstSeen.IsZero() {
+					r.FirstSeen, r.LastSeen = now, now
+				}
+
+				if err := txn.Set([]byte(LegacyNamespace+Separator+string(p.key)), r.Encode(), 0); err != nil {
+					return err
+				}
+				if err := txn.Delete(p.key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.update(func(txn *badger.Txn) error {
+		return txn.Set(schemaKey, []byte(SchemaVersion), 0)
+	})
+}
+
+// count - number of keys with prefix
+func (b *Badger) count(prefix string) (int64, error) {
+	var n int64
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory - SeenStore kept in memory, for tests and dry runs
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// NewMemory - create empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{records: make(map[string]*Record)}
+}
+
+// Has - whether key is seen
+func (m *Memory) Has(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.records[key]
+	return ok, nil
+}
+
+// Get - record of key, nil if it isn't seen
+func (m *Memory) Get(key string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return r.copy(), nil
+}
+
+// Scan - call fn with each key with prefix and its record, in key order
+func (m *Memory) Scan(prefix string, fn func(key string, r *Record) error) error {
+	m.mu.Lock()
+	var keys []string
+	records := make(map[string]*Record)
+	for k, r := range m.records {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+			records[k] = r.copy()
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn(k, records[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mark - mark key seen, returns false if it is seen already
+func (m *Memory) Mark(key string) (bool, error) {
+	state, err := m.MarkWithMeta(key, Meta{})
+	return state.IsNew(), err
+}
+
+// MarkWithMeta - mark key seen with meta, returns its state
+func (m *Memory) MarkWithMeta(key string, meta Meta) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if r, ok := m.records[key]; ok {
+		return r.mark(meta, now), nil
+	}
+	m.records[key] = newRecord(meta, now)
+	return StateNew, nil
+}
+
+// Expire - forget key
+func (m *Memory) Expire(key string) error {
+	m.mu.Lock()
+	delete(m.records, key)
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RecordVersion - version of encoding of records written, the first byte of a value
+const RecordVersion = 1
+
+// Status of an item
+const (
+	StatusSeen   = "seen"   // collected
+	StatusDone   = "done"   // handled, e.g. downloaded
+	StatusFailed = "failed" // handling failed, e.g. download error
+)
+
+// State - whether an item marked is new
+type State string
+
+// States of an item marked
+const (
+	StateNew     State = "new"     // not seen before
+	StateSeen    State = "seen"    // seen before
+	StateExpired State = "expired" // seen before, but not for longer than Policy.TTL
+	StateChanged State = "changed" // seen before with other content, see Policy.Resurface
+)
+
+// IsNew - whether item is taken as new, i.e. not seen or resurfaced
+func (s State) IsNew() bool {
+	return s != StateSeen
+}
+
+// Policy - when an item seen before is taken as new again
+type Policy struct {
+	// item not seen for longer than TTL, zero means never
+	TTL time.Duration
+	// item whose content hash changed
+	Resurface bool
+}
+
+// Meta - what is known of an item when it is marked
+type Meta struct {
+	// url the item is found at
+	Source string
+	// StatusSeen if empty
+	Status string
+	// hash of the item's content, see Hash
+	Hash string
+	// fields of the item as observed, added to its history if they changed
+	Fields map[string]string
+
+	// set by WithPolicy
+	policy Policy
+}
+
+// Record - an item seen, as stored
+type Record struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Source    string    `json:"source,omitempty"`
+	Status    string    `json:"status"`
+	Hash      string    `json:"hash,omitempty"`
+	// times the item is taken as new again
+	Resurfaced int `json:"resurfaced,omitempty"`
+	// fields observed, oldest first and at most maxObservations
+	History []Observation `json:"history,omitempty"`
+}
+
+// Observation - fields of an item, unchanged from First to Last seen
+type Observation struct {
+	First  time.Time         `json:"first"`
+	Last   time.Time         `json:"last"`
+	Fields map[string]string `json:"fields"`
+}
+
+// maxObservations - max length of history of a record, older observations are dropped
+const maxObservations = 100
+
+// Observed - last observation, nil if there is none
+func (r *Record) Observed() *Observation {
+	if len(r.History) == 0 {
+		return nil
+	}
+	return &r.History[len(r.History)-1]
+}
+
+// newRecord - record of item first seen at now
+func newRecord(meta Meta, now time.Time) *Record {
+	r := &Record{FirstSeen: now, Status: StatusSeen}
+	r.update(meta, now)
+	return r
+}
+
+// state - state of item seen again at now with meta
+func (r *Record) state(meta Meta, now time.Time) State {
+	p := meta.policy
+	switch {
+	case p.TTL > 0 && now.Sub(r.LastSeen) > p.TTL:
+		return StateExpired
+	case p.Resurface && meta.Hash != "" && r.Hash != "" && meta.Hash != r.Hash:
+		return StateChanged
+	}
+	return StateSeen
+}
+
+// mark - item seen again at now with meta, returns its state
+func (r *Record) mark(meta Meta, now time.Time) State {
+	state := r.state(meta, now)
+	if state.IsNew() {
+		r.Resurfaced++
+	}
+	r.update(meta, now)
+	return state
+}
+
+// update - fields set in meta replace the recorded ones
+func (r *Record) update(meta Meta, now time.Time) {
+	r.LastSeen = now
+	if meta.Source != "" {
+		r.Source = meta.Source
+	}
+	if meta.Status != "" {
+		r.Status = meta.Status
+	}
+	if meta.Hash != "" {
+		r.Hash = meta.Hash
+	}
+	if meta.Fields != nil {
+		r.observe(meta.Fields, now)
+	}
+}
+
+// observe - fields observed at now, which extend the last observation if they are the same
+func (r *Record) observe(fields map[string]string, now time.Time) {
+	if o := r.Observed(); o != nil && sameFields(o.Fields, fields) {
+		o.Last = now
+		return
+	}
+
+	r.History = append(r.History, Observation{First: now, Last: now, Fields: fields})
+	if n := len(r.History); n > maxObservations {
+		r.History = r.History[n-maxObservations:]
+	}
+}
+
+func sameFields(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// copy - deep copy of record
+func (r *Record) copy() *Record {
+	c := *r
+	c.History = make([]Observation, len(r.History))
+	for k, o := range r.History {
+		c.History[k] = o
+		c.History[k].Fields = make(map[string]string, len(o.Fields))
+		for name, v := range o.Fields {
+			c.History[k].Fields[name] = v
+		}
+	}
+	return &c
+}
+
+// Encode - value of record, RecordVersion followed by its json
+func (r *Record) Encode() []byte {
+	data, _ := json.Marshal(r)
+	return append([]byte{RecordVersion}, data...)
+}
+
+// DecodeRecord - record of value written by Encode, or of a legacy value, which
+// is "1" for a downloaded image and "0" or empty for anything else seen
+func DecodeRecord(value []byte) (*Record, error) {
+	if len(value) == 0 || value[0] != RecordVersion {
+		return legacyRecord(value)
+	}
+
+	var r Record
+	if err := json.Unmarshal(value[1:], &r); err != nil {
+		return nil, fmt.Errorf("invalid record: %v", err)
+	}
+	return &r, nil
+}
+
+func legacyRecord(value []byte) (*Record, error) {
+	switch string(value) {
+	case "", "0":
+		return &Record{Status: StatusSeen}, nil
+	case "1":
+		return &Record{Status: StatusDone}, nil
+	}
+	return nil, fmt.Errorf("unknown record version %d", value[0])
+}
+
+// Hash - hash of v's json, telling whether content of an item changed
+func Hash(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(fmt.Sprint(v))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,119 @@
+// Package store - remember items seen by insighters across runs
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// SeenStore - records of items seen by key, safe for concurrent use
+type SeenStore interface {
+	// Has - whether key is seen
+	Has(key string) (bool, error)
+	// Get - record of key, nil if it isn't seen
+	Get(key string) (*Record, error)
+	// Mark - mark key seen, returns false if it is seen already
+	Mark(key string) (bool, error)
+	// MarkWithMeta - mark key seen with meta, which replaces fields recorded
+	// for a key seen already. Returns StateNew if it isn't seen, StateSeen if
+	// it is, or the reason it is taken as new again under policy set by WithPolicy.
+	MarkWithMeta(key string, meta Meta) (State, error)
+	// Expire - forget key, so that it is new to the next Mark
+	Expire(key string) error
+	// Scan - call fn with each key with prefix and its record, in key order,
+	// stopping at the first error. fn must not change the store.
+	Scan(prefix string, fn func(key string, r *Record) error) error
+}
+
+// Separator - separator of namespace and key
+const Separator = "/"
+
+// Namespace - view of s where every key is prefixed with `<ns>/`,
+// so that insighters sharing s don't collide
+func Namespace(s SeenStore, ns string) SeenStore {
+	return &namespaced{s: s, prefix: ns + Separator}
+}
+
+// SplitKey - namespace and key of a namespaced key, namespace is empty if there is none
+func SplitKey(key string) (ns, rest string) {
+	if k := strings.Index(key, Separator); k >= 0 {
+		return key[:k], key[k+1:]
+	}
+	return "", key
+}
+
+type namespaced struct {
+	s      SeenStore
+	prefix string
+}
+
+func (n *namespaced) Has(key string) (bool, error) {
+	return n.s.Has(n.prefix + key)
+}
+
+func (n *namespaced) Get(key string) (*Record, error) {
+	return n.s.Get(n.prefix + key)
+}
+
+func (n *namespaced) Mark(key string) (bool, error) {
+	return n.s.Mark(n.prefix + key)
+}
+
+func (n *namespaced) MarkWithMeta(key string, meta Meta) (State, error) {
+	return n.s.MarkWithMeta(n.prefix+key, meta)
+}
+
+func (n *namespaced) Expire(key string) error {
+	return n.s.Expire(n.prefix + key)
+}
+
+func (n *namespaced) Scan(prefix string, fn func(key string, r *Record) error) error {
+	return n.s.Scan(n.prefix+prefix, func(key string, r *Record) error {
+		return fn(strings.TrimPrefix(key, n.prefix), r)
+	})
+}
+
+// WithPolicy - view of s where items are taken as new again under p, by Has and Mark
+// as well as MarkWithMeta
+func WithPolicy(s SeenStore, p Policy) SeenStore {
+	if p == (Policy{}) {
+		return s
+	}
+	return &policied{s: s, p: p}
+}
+
+type policied struct {
+	s SeenStore
+	p Policy
+}
+
+// Has - whether key is seen and not expired, a change of content is only told by marking it
+func (w *policied) Has(key string) (bool, error) {
+	r, err := w.s.Get(key)
+	if r == nil || err != nil {
+		return false, err
+	}
+	return r.state(Meta{policy: w.p}, time.Now()) != StateExpired, nil
+}
+
+func (w *policied) Get(key string) (*Record, error) {
+	return w.s.Get(key)
+}
+
+func (w *policied) Mark(key string) (bool, error) {
+	state, err := w.MarkWithMeta(key, Meta{})
+	return state.IsNew(), err
+}
+
+func (w *policied) MarkWithMeta(key string, meta Meta) (State, error) {
+	meta.policy = w.p
+	return w.s.MarkWithMeta(key, meta)
+}
+
+func (w *policied) Expire(key string) error {
+	return w.s.Expire(key)
+}
+
+func (w *policied) Scan(prefix string, fn func(key string, r *Record) error) error {
+	return w.s.Scan(prefix, fn)
+}
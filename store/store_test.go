@@ -0,0 +1,253 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+func testSeenStore(t *testing.T, s SeenStore) {
+	if ok, err := s.Has("a"); ok || err != nil {
+		t.Fatalf("Has(a) of empty store == %v, %v", ok, err)
+	}
+
+	if isNew, err := s.Mark("a"); !isNew || err != nil {
+		t.Errorf("first Mark(a) == %v, %v, want new", isNew, err)
+	}
+	if isNew, _ := s.Mark("a"); isNew {
+		t.Error("second Mark(a) should not be new")
+	}
+	if ok, _ := s.Has("a"); !ok {
+		t.Error("a should be seen after Mark")
+	}
+
+	if state, _ := s.MarkWithMeta("b", Meta{Source: "http://example.com/b", Hash: "1"}); state != StateNew {
+		t.Errorf("first MarkWithMeta(b) == %v, want new", state)
+	}
+	// without policy, changed content isn't new
+	if state, _ := s.MarkWithMeta("b", Meta{Status: StatusDone, Hash: "2"}); state != StateSeen {
+		t.Errorf("second MarkWithMeta(b) == %v, want seen", state)
+	}
+	r, err := s.Get("b")
+	if err != nil || r == nil || r.Source != "http://example.com/b" || r.Status != StatusDone ||
+		r.Hash != "2" || r.FirstSeen.IsZero() || r.LastSeen.Before(r.FirstSeen) {
+		t.Errorf("Get(b) == %+v, %v, want fields of both marks", r, err)
+	}
+
+	// history keeps distinct observations
+	for _, price := range []string{"1", "1", "2"} {
+		s.MarkWithMeta("c", Meta{Fields: map[string]string{"price": price}})
+	}
+	if r, _ := s.Get("c"); len(r.History) != 2 || r.Observed().Fields["price"] != "2" ||
+		r.History[0].Last.Before(r.History[0].First) {
+		t.Errorf("history of c == %+v, want prices 1 and 2", r.History)
+	}
+
+	var keys []string
+	s.Scan("", func(key string, r *Record) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if strings.Join(keys, ",") != "a,b,c" {
+		t.Errorf("Scan == %v, want a, b and c", keys)
+	}
+
+	if err := s.Expire("a"); err != nil {
+		t.Fatal(err)
+	}
+	if isNew, _ := s.Mark("a"); !isNew {
+		t.Error("Mark(a) after Expire should be new")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testSeenStore(t, NewMemory())
+}
+
+func TestNamespace(t *testing.T) {
+	m := NewMemory()
+	a, b := Namespace(m, "a"), Namespace(m, "b")
+
+	a.Mark("key")
+	if ok, _ := b.Has("key"); ok {
+		t.Error("key marked in namespace a should not be seen in namespace b")
+	}
+	if ok, _ := m.Has("a/key"); !ok {
+		t.Error("key marked in namespace a should be stored as a/key")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	m := NewMemory()
+	s := WithPolicy(m, Policy{TTL: time.Hour, Resurface: true})
+
+	s.MarkWithMeta("a", Meta{Hash: "1"})
+	if state, _ := s.MarkWithMeta("a", Meta{Hash: "1"}); state != StateSeen {
+		t.Errorf("unchanged a == %v, want seen", state)
+	}
+	if state, _ := s.MarkWithMeta("a", Meta{Hash: "2"}); state != StateChanged {
+		t.Errorf("changed a == %v, want changed", state)
+	}
+
+	// a not seen for longer than TTL
+	m.records["a"].LastSeen = time.Now().Add(-2 * time.Hour)
+	if ok, _ := s.Has("a"); ok {
+		t.Error("expired a should not be seen")
+	}
+	if state, _ := s.MarkWithMeta("a", Meta{Hash: "2"}); state != StateExpired {
+		t.Errorf("expired a == %v, want expired", state)
+	}
+	if r, _ := s.Get("a"); r.Resurfaced != 2 {
+		t.Errorf("a resurfaced %d times, want 2", r.Resurfaced)
+	}
+	if isNew, _ := s.Mark("a"); isNew {
+		t.Error("a marked again should not be new")
+	}
+}
+
+func TestBadger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbDir := filepath.Join(dir, "badger")
+	b, err := OpenBadger(dbDir, dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSeenStore(t, b)
+	b.Close()
+
+	// marks are committed and kept across runs
+	b, err = OpenBadger(dbDir, dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, key := range []string{"a", "b"} {
+		if ok, err := b.Has(key); !ok || err != nil {
+			t.Errorf("Has(%s) after reopen == %v, %v", key, ok, err)
+		}
+	}
+}
+
+func TestBadgerMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// db of the format before namespaces
+	opts := badger.DefaultOptions
+	opts.Dir, opts.ValueDir = dir, dir
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		txn.Set([]byte("http://example.com/a.jpg"), []byte("1"), 0)
+		return txn.Set([]byte("title_room"), []byte("0"), 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBadger(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if r, err := b.Get(LegacyNamespace + "/http://example.com/a.jpg"); err != nil || r == nil || r.Status != StatusDone {
+		t.Errorf("legacy record == %+v, %v, want done", r, err)
+	}
+
+	// legacy record is found by any namespace, and claimed by the first marking it
+	tc := Namespace(b, "rent-tc")
+	if ok, _ := tc.Has("title_room"); !ok {
+		t.Error("legacy key should be seen")
+	}
+	if isNew, _ := tc.Mark("title_room"); isNew {
+		t.Error("legacy key should not be new")
+	}
+	if ok, _ := b.Has(LegacyNamespace + "/title_room"); ok {
+		t.Error("claimed legacy key should be moved")
+	}
+	if ok, _ := Namespace(b, "rent-ganji").Has("title_room"); ok {
+		t.Error("claimed legacy key should not be seen by other namespaces")
+	}
+
+	// schema is set, so the store isn't migrated again
+	if _, err := NewBadger(db); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := tc.Has("title_room"); !ok {
+		t.Error("claimed key should be kept")
+	}
+}
+
+func TestBadgerAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := OpenBadger(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	old := time.Now().Add(-48 * time.Hour)
+	err = b.Put([]Entry{
+		{Key: "rent-tc/old", Record: &Record{FirstSeen: old, LastSeen: old, Status: StatusSeen}},
+		{Key: "rent-tc/recent", Record: &Record{FirstSeen: old, LastSeen: time.Now(), Status: StatusSeen}},
+		{Key: "json-image/a.jpg", Record: &Record{FirstSeen: old, LastSeen: old, Status: StatusDone}},
+		{Key: LegacyNamespace + "/title_room", Record: &Record{Status: StatusSeen}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := b.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range stats {
+		names = append(names, s.Namespace)
+	}
+	// schema is counted in _meta
+	if strings.Join(names, ",") != "_legacy,_meta,json-image,rent-tc" || stats[3].Keys != 2 || stats[3].Bytes == 0 {
+		t.Errorf("Stats == %+v", stats)
+	}
+
+	// imported legacy record is found
+	if ok, _ := Namespace(b, "rent-ganji").Has("title_room"); !ok {
+		t.Error("imported legacy key should be seen")
+	}
+
+	if n, err := b.Purge("rent-tc/", time.Now().Add(-time.Hour)); n != 1 || err != nil {
+		t.Errorf("Purge(rent-tc/) == %d, %v, want 1", n, err)
+	}
+	if ok, _ := b.Has("rent-tc/old"); ok {
+		t.Error("purged key should not be seen")
+	}
+	if ok, _ := b.Has("rent-tc/recent"); !ok {
+		t.Error("key seen recently should be kept")
+	}
+
+	if _, err := b.GC(0.5); err != nil {
+		t.Errorf("GC error: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieJar - cookie jar which can be loaded from and saved to a Netscape
+// cookies.txt file, so that cookies are kept between runs
+type CookieJar struct {
+	mu      sync.Mutex
+	file    string
+	cookies map[string]*jarCookie
+}
+
+type jarCookie struct {
+	Domain   string
+	HostOnly bool
+	Path     string
+	Secure   bool
+	HTTPOnly bool
+	Expires  time.Time // zero for session cookies
+	Name     string
+	Value    string
+}
+
+func (c *jarCookie) key() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+func (c *jarCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && c.Expires.Before(now)
+}
+
+// NewCookieJar - create jar saved to file on every change,
+// cookies of the file are loaded if it exists. Empty file means memory only.
+func NewCookieJar(file string) (*CookieJar, error) {
+	j := &CookieJar{file: file, cookies: make(map[string]*jarCookie)}
+
+	if file != "" {
+		if exists, _ := Exists(file); exists {
+			if err := j.Load(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return j, nil
+}
+
+// Load - add cookies of a Netscape cookies.txt file, e.g. exported from a browser
+func (j *CookieJar) Load(fp string) error {
+	file, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("%s:%d: expect 7 tab separated fields, got %d", fp, n, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid expiry %q", fp, n, fields[4])
+		}
+
+		c := &jarCookie{
+			Domain:   strings.TrimPrefix(fields[0], "."),
+			HostOnly: fields[1] != "TRUE",
+			Path:     fields[2],
+			Secure:   fields[3] == "TRUE",
+			HTTPOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		j.cookies[c.key()] = c
+	}
+
+	return scanner.Err()
+}
+
+// SetCookies - implement http.CookieJar
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := u.Hostname()
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	changed := false
+	for _, hc := range cookies {
+		c := &jarCookie{
+			Domain:   host,
+			HostOnly: true,
+			Path:     hc.Path,
+			Secure:   hc.Secure,
+			HTTPOnly: hc.HttpOnly,
+			Expires:  hc.Expires,
+			Name:     hc.Name,
+			Value:    hc.Value,
+		}
+
+		if hc.Domain != "" {
+			domain := strings.ToLower(strings.TrimPrefix(hc.Domain, "."))
+			if !domainMatch(host, domain) {
+				continue
+			}
+			c.Domain, c.HostOnly = domain, false
+		}
+
+		if c.Path == "" || !strings.HasPrefix(c.Path, "/") {
+			c.Path = path.Dir(u.EscapedPath())
+			if !strings.HasPrefix(c.Path, "/") {
+				c.Path = "/"
+			}
+		}
+
+		switch {
+		case hc.MaxAge < 0:
+			c.Expires = now.Add(-time.Second)
+		case hc.MaxAge > 0:
+			c.Expires = now.Add(time.Duration(hc.MaxAge) * time.Second)
+		}
+
+		if c.expired(now) {
+			if _, ok := j.cookies[c.key()]; ok {
+				delete(j.cookies, c.key())
+				changed = true
+			}
+			continue
+		}
+
+		j.cookies[c.key()] = c
+		changed = true
+	}
+
+	if changed && j.file != "" {
+		if err := j.save(); err != nil {
+			logger.Infow("save cookie jar error", "file", j.file, "error", err)
+		}
+	}
+}
+
+// Cookies - implement http.CookieJar
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host := u.Hostname()
+	reqPath := u.EscapedPath()
+	if reqPath == "" {
+		reqPath = "/"
+	}
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var matched []*jarCookie
+	for _, c := range j.cookies {
+		if c.expired(now) || (c.Secure && u.Scheme != "https") {
+			continue
+		}
+		if c.HostOnly && host != c.Domain || !c.HostOnly && !domainMatch(host, c.Domain) {
+			continue
+		}
+		if !pathMatch(reqPath, c.Path) {
+			continue
+		}
+		matched = append(matched, c)
+	}
+
+	// longer paths first, as browsers do
+	sort.Slice(matched, func(a, b int) bool {
+		if len(matched[a].Path) != len(matched[b].Path) {
+			return len(matched[a].Path) > len(matched[b].Path)
+		}
+		return matched[a].Name < matched[b].Name
+	})
+
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, c := range matched {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
+
+// save - write cookies to file in Netscape cookies.txt format, replacing it atomically
+func (j *CookieJar) save() error {
+	if err := os.MkdirAll(filepath.Dir(j.file), os.ModePerm); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(j.cookies))
+	for key := range j.cookies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	for _, key := range keys {
+		c := j.cookies[key]
+
+		domain := c.Domain
+		if c.HTTPOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!c.HostOnly), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(j.file), filepath.Base(j.file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), j.file)
+}
+
+// readSetCookies - cookies set by response header. Unlike http.Response.Cookies,
+// names which are not http tokens, e.g. `main[UTMPUSERID]` of nForum, are kept.
+func readSetCookies(h http.Header) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, line := range h["Set-Cookie"] {
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			continue
+		}
+
+		// parse with a valid name in place of the original one
+		name := strings.TrimSpace(line[:eq])
+		c, err := http.ParseSetCookie("x" + line[eq:])
+		if err != nil {
+			continue
+		}
+		c.Name = name
+		cookies = append(cookies, c)
+	}
+	return cookies
+}
+
+func netscapeBool(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func pathMatch(reqPath, cookiePath string) bool {
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return len(reqPath) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
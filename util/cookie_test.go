@@ -0,0 +1,109 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func cookieNames(cookies []*http.Cookie) []string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestCookieJar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "jar.txt")
+	jar, err := NewCookieJar(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("http://www.example.com/a/b")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/", HttpOnly: true},
+		{Name: "secure", Value: "3", Path: "/", Secure: true},
+		{Name: "other", Value: "4", Domain: "other.com"},
+	})
+
+	cases := []struct {
+		url  string
+		want []string
+	}{
+		{"http://www.example.com/a/c", []string{"host", "domain"}},
+		{"https://www.example.com/", []string{"domain", "secure"}},
+		{"http://img.example.com/a/c", []string{"domain"}},
+		{"http://other.com/", nil},
+	}
+
+	// cookies are the same once the jar is loaded from its file
+	loaded, err := NewCookieJar(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, j := range []*CookieJar{jar, loaded} {
+		for _, c := range cases {
+			u, _ := url.Parse(c.url)
+			got := cookieNames(j.Cookies(u))
+			if len(got) != len(c.want) {
+				t.Errorf("cookies of %s == %v, want %v", c.url, got, c.want)
+				continue
+			}
+			for k := range got {
+				if got[k] != c.want[k] {
+					t.Errorf("cookies of %s == %v, want %v", c.url, got, c.want)
+					break
+				}
+			}
+		}
+	}
+
+	// deleted by negative MaxAge
+	jar.SetCookies(u, []*http.Cookie{{Name: "domain", Domain: "example.com", Path: "/", MaxAge: -1}})
+	loaded, _ = NewCookieJar(fp)
+	if got := cookieNames(loaded.Cookies(u)); len(got) != 1 || got[0] != "host" {
+		t.Errorf("cookies after delete == %v, want [host]", got)
+	}
+}
+
+func TestCookieJarLoad(t *testing.T) {
+	f, err := ioutil.TempFile("", "cookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("# Netscape HTTP Cookie File\n\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/\tFALSE\t4102444800\tid\t42\n" +
+		"www.example.com\tFALSE\t/\tFALSE\t1\texpired\tx\n")
+	f.Close()
+
+	jar, _ := NewCookieJar("")
+	if err = jar.Load(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("http://www.example.com/")
+	if got := cookieNames(jar.Cookies(u)); len(got) != 2 || got[0] != "id" || got[1] != "session" {
+		t.Errorf("cookies == %v, want [id session]", got)
+	}
+
+	ioutil.WriteFile(f.Name(), []byte("example.com\tTRUE\t/\n"), 0644)
+	if err = jar.Load(f.Name()); err == nil {
+		t.Error("malformed line should fail")
+	}
+}
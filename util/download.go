@@ -0,0 +1,418 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrTooLarge - download exceeds max size
+var ErrTooLarge = errors.New("download exceeds max size")
+
+// ChecksumSuffix - suffix of file recording SHA-256 of a download,
+// in `sha256sum` format so that it can be checked with `sha256sum -c`
+const ChecksumSuffix = ".sha256"
+
+// PartSuffix - suffix of file holding a partial download
+const PartSuffix = ".part"
+
+// partMetaSuffix - suffix of file telling which resource a part belongs to
+const partMetaSuffix = PartSuffix + ".meta"
+
+// partMeta - resource a part belongs to
+type partMeta struct {
+	URL string `json:"url"`
+	// strong ETag or Last-Modified of the resource, sent as `If-Range`
+	Validator string `json:"validator"`
+}
+
+// DownloadOptions - how a file is downloaded
+type DownloadOptions struct {
+	// download again even if file exists
+	Overwrite bool
+	// max number of bytes, zero means no limit
+	MaxSize int64
+	// record SHA-256 of file in `<file>.sha256`
+	Checksum bool
+}
+
+// DownloadWith - download url to fp with client, e.g. one made by basic.NewHTTPClient
+// rotating through proxies, returns number of bytes written, which is zero if file
+// exists and is not to be overwritten
+func DownloadWith(client *http.Client, url, fp string, overwrite bool) (int64, error) {
+	return DownloadFile(client, url, fp, DownloadOptions{Overwrite: overwrite})
+}
+
+// DownloadFile - stream body of url to `<fp>.part`, which is renamed to fp once
+// the body is complete, so fp is either absent or a whole download. A part left
+// by an interrupted attempt is resumed with a range request if the server
+// supports it, otherwise the file is fetched from the start. Returns number of
+// bytes written, zero if fp exists and is not to be overwritten.
+func DownloadFile(client *http.Client, url, fp string, opts DownloadOptions) (int64, error) {
+	if exists, _ := Exists(fp); exists && !opts.Overwrite {
+		return 0, nil
+	}
+
+	_, n, err := download(client, url, fp, false, opts)
+	return n, err
+}
+
+// DownloadResource - download url into dir, named by ResourceName(url).
+// Returns path of the file and number of bytes written.
+func DownloadResource(client *http.Client, url, dir string, opts DownloadOptions) (string, int64, error) {
+	name, ext := ResourceName(url)
+	return DownloadAs(client, url, filepath.Join(dir, name), ext, opts)
+}
+
+// DownloadAs - download url to `<base><ext>`. If ext is empty, it is detected
+// from `Content-Type` or content of the download, and a file of base with any
+// extension counts as existing. Returns path of the file and number of bytes written.
+func DownloadAs(client *http.Client, url, base, ext string, opts DownloadOptions) (string, int64, error) {
+	if ext != "" {
+		n, err := DownloadFile(client, url, base+ext, opts)
+		return base + ext, n, err
+	}
+
+	if fp := findDownload(base); fp != "" && !opts.Overwrite {
+		return fp, 0, nil
+	}
+
+	return download(client, url, base, true, opts)
+}
+
+// findDownload - complete download of base with any extension, empty if none
+func findDownload(base string) string {
+	files, err := ioutil.ReadDir(filepath.Dir(base))
+	if err != nil {
+		return ""
+	}
+
+	name := filepath.Base(base)
+	for _, info := range files {
+		fn := info.Name()
+		if info.IsDir() || (fn != name && !strings.HasPrefix(fn, name+".")) {
+			continue
+		}
+		ext := strings.TrimPrefix(fn, name)
+		if ext == "" || (validExt.MatchString(ext) && ext != PartSuffix) {
+			return filepath.Join(filepath.Dir(base), fn)
+		}
+	}
+
+	return ""
+}
+
+// download - download url to fp, with extension detected once done if detectExt.
+// Returns path of the file and number of bytes written.
+func download(client *http.Client, url, fp string, detectExt bool, opts DownloadOptions) (string, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fp), os.ModePerm); err != nil {
+		return "", 0, err
+	}
+
+	part := fp + PartSuffix
+	offset, validator := resumable(url, part)
+
+	resp, err := getRange(client, url, offset, validator)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	// part is stale, e.g. file has shrunk, fetch it again from the start
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		resp.Body.Close()
+		removePart(part)
+
+		offset = 0
+		if resp, err = getRange(client, url, 0, ""); err != nil {
+			return "", 0, err
+		}
+		defer resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// range is ignored or part has changed on server
+		offset = 0
+	case http.StatusPartialContent:
+		if offset == 0 || contentRangeStart(resp) != offset {
+			removePart(part)
+			return "", 0, fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range"))
+		}
+	default:
+		// resource is gone, part is useless
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			removePart(part)
+		}
+		return "", 0, fmt.Errorf("Status Code Is Not %d", http.StatusOK)
+	}
+
+	if opts.MaxSize > 0 && resp.ContentLength >= 0 && offset+resp.ContentLength > opts.MaxSize {
+		removePart(part)
+		return "", 0, ErrTooLarge
+	}
+
+	n, sum, err := writePart(part, url, offset, resp, opts)
+	if err != nil {
+		// part is kept for next attempt unless it can never complete
+		if err == ErrTooLarge {
+			removePart(part)
+		}
+		return "", n, err
+	}
+
+	if detectExt {
+		fp += DetectExtension(resp.Header.Get("Content-Type"), readHead(part))
+	}
+
+	if err = os.Rename(part, fp); err != nil {
+		return "", n, err
+	}
+	os.Remove(part + partMetaSuffix)
+
+	if sum != "" {
+		err = WriteChecksum(fp, sum)
+	}
+
+	return fp, n, err
+}
+
+// readHead - first bytes of fp used to sniff its content type
+func readHead(fp string) []byte {
+	file, err := os.Open(fp)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return head[:n]
+}
+
+// getRange - GET url from offset on, if the resource is still the one identified by validator
+func getRange(client *http.Client, url string, offset int64, validator string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	return client.Do(req)
+}
+
+// writePart - write body of resp to part from offset on, returns number of bytes
+// written and hex SHA-256 of the whole part if checksum is asked
+func writePart(part, url string, offset int64, resp *http.Response, opts DownloadOptions) (int64, string, error) {
+	// meta is written first, so that part can be resumed once interrupted,
+	// a resumed part keeps its meta
+	if offset == 0 {
+		if err := writePartMeta(part, url, rangeValidator(resp)); err != nil {
+			return 0, "", err
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(part, flag, 0600)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var sum hash.Hash
+	if opts.Checksum {
+		sum = sha256.New()
+		if offset > 0 {
+			if err = hashFile(sum, part, offset); err != nil {
+				file.Close()
+				return 0, "", err
+			}
+		}
+	}
+
+	var w io.Writer = file
+	if sum != nil {
+		w = io.MultiWriter(file, sum)
+	}
+
+	body := io.Reader(resp.Body)
+	if opts.MaxSize > 0 {
+		// one more byte to tell a body of exactly MaxSize from a larger one
+		body = io.LimitReader(body, opts.MaxSize-offset+1)
+	}
+
+	n, err := io.Copy(w, body)
+	if err == nil && opts.MaxSize > 0 && offset+n > opts.MaxSize {
+		err = ErrTooLarge
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, "", err
+	}
+
+	if sum == nil {
+		return n, "", nil
+	}
+	return n, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// writePartMeta - record resource of part, part without validator can't be resumed
+func writePartMeta(part, url, validator string) error {
+	if validator == "" {
+		os.Remove(part + partMetaSuffix)
+		return nil
+	}
+
+	data, err := json.Marshal(partMeta{URL: url, Validator: validator})
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(part+partMetaSuffix, data)
+}
+
+// resumable - offset and validator to resume part of url from,
+// part that can't be resumed is removed
+func resumable(url, part string) (int64, string) {
+	info, err := os.Stat(part)
+	if err != nil {
+		return 0, ""
+	}
+
+	var meta partMeta
+	data, err := ioutil.ReadFile(part + partMetaSuffix)
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil || meta.URL != url || meta.Validator == "" || info.Size() == 0 {
+		removePart(part)
+		return 0, ""
+	}
+
+	return info.Size(), meta.Validator
+}
+
+// rangeValidator - validator of resp usable in `If-Range`, weak ETags are not
+func rangeValidator(resp *http.Response) string {
+	if resp.Header.Get("Accept-Ranges") == "none" {
+		return ""
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart - first byte position of `Content-Range: bytes <start>-<end>/<size>`
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end int64
+	var size string
+	cr := resp.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return -1
+	}
+	return start
+}
+
+func removePart(part string) {
+	os.Remove(part)
+	os.Remove(part + partMetaSuffix)
+}
+
+// hashFile - write first n bytes of fp to h
+func hashFile(h hash.Hash, fp string, n int64) error {
+	file, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(h, file, n)
+	return err
+}
+
+// WriteChecksum - record hex SHA-256 of fp in its checksum file
+func WriteChecksum(fp, sum string) error {
+	line := sum + "  " + filepath.Base(fp) + "\n"
+	return WriteFileAtomic(fp+ChecksumSuffix, []byte(line))
+}
+
+// ReadChecksum - hex SHA-256 of fp recorded in its checksum file
+func ReadChecksum(fp string) (string, error) {
+	data, err := ioutil.ReadFile(fp + ChecksumSuffix)
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum file of %s", fp)
+	}
+	return fields[0], nil
+}
+
+// FileChecksum - hex SHA-256 of content of fp
+func FileChecksum(fp string) (string, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	if _, err = io.Copy(sum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// WriteFileAtomic - write data to fp through a temp file, so that fp is
+// either its old content or data, never a partial write
+func WriteFileAtomic(fp string, data []byte) error {
+	_, err := writeFileAtomic(fp, func(w io.Writer) (int64, error) {
+		n, err := w.Write(data)
+		return int64(n), err
+	})
+	return err
+}
+
+// writeFileAtomic - write content by write to a temp file in the directory of fp,
+// and rename it to fp on success. The temp file is removed on failure.
+func writeFileAtomic(fp string, write func(w io.Writer) (int64, error)) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fp), os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fp), "."+filepath.Base(fp)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := write(tmp)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err = tmp.Close(); err != nil {
+		return n, err
+	}
+
+	return n, os.Rename(tmp.Name(), fp)
+}
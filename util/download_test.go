@@ -0,0 +1,163 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDownloadFile(t *testing.T) {
+	body := "hello world"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(body))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &http.Client{}
+	fp := filepath.Join(dir, "a", "file.txt")
+
+	n, err := DownloadFile(client, ts.URL+"/file", fp, DownloadOptions{Checksum: true})
+	if err != nil || n != int64(len(body)) {
+		t.Fatalf("DownloadFile == %d, %v, want %d, nil", n, err, len(body))
+	}
+
+	want := sha256.Sum256([]byte(body))
+	if sum, _ := ReadChecksum(fp); sum != hex.EncodeToString(want[:]) {
+		t.Errorf("checksum == %q, want %x", sum, want)
+	}
+
+	// existing file is kept
+	if n, _ = DownloadFile(client, ts.URL+"/file", fp, DownloadOptions{}); n != 0 {
+		t.Errorf("download of existing file == %d bytes, want 0", n)
+	}
+
+	// shorter re-download leaves no trailing bytes
+	body = "hi"
+	if _, err = DownloadFile(client, ts.URL+"/file", fp, DownloadOptions{Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(fp); string(data) != body {
+		t.Errorf("content == %q, want %q", data, body)
+	}
+
+	// failed downloads leave nothing behind
+	body = "too large"
+	failed := []struct {
+		url  string
+		opts DownloadOptions
+	}{
+		{ts.URL + "/missing", DownloadOptions{}},
+		{ts.URL + "/file", DownloadOptions{MaxSize: 4}},
+	}
+	for _, c := range failed {
+		fp := filepath.Join(dir, "b", "failed.txt")
+		if _, err = DownloadFile(client, c.url, fp, c.opts); err == nil {
+			t.Errorf("download of %s with %+v should fail", c.url, c.opts)
+		}
+		if exists, _ := Exists(fp); exists {
+			t.Errorf("failed download of %s leaves file", c.url)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, "b")); len(files) != 0 {
+		t.Errorf("failed downloads leave %d files, want 0", len(files))
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	etag := `"v1"`
+	interrupt, ranges := true, true
+	var rangeHeaders []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeaders = append(rangeHeaders, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+
+		if interrupt {
+			interrupt = false
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:10])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		if !ranges {
+			w.Write(content)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &http.Client{}
+	want := sha256.Sum256(content)
+
+	cases := []struct {
+		name   string
+		ranges bool
+		etag   string
+		rng    string
+		n      int64
+	}{
+		{"resumed", true, `"v1"`, "bytes=10-", int64(len(content) - 10)},
+		{"no range support", false, `"v1"`, "bytes=10-", int64(len(content))},
+		{"changed", true, `"v2"`, "bytes=10-", int64(len(content))},
+	}
+
+	for k, c := range cases {
+		fp := filepath.Join(dir, strconv.Itoa(k), "file.bin")
+		interrupt, ranges, etag, rangeHeaders = true, c.ranges, `"v1"`, nil
+
+		if _, err = DownloadFile(client, ts.URL, fp, DownloadOptions{Checksum: true}); err == nil {
+			t.Fatalf("%s: interrupted download should fail", c.name)
+		}
+		if exists, _ := Exists(fp + PartSuffix); !exists {
+			t.Fatalf("%s: part of interrupted download is removed", c.name)
+		}
+
+		etag = c.etag
+		n, err := DownloadFile(client, ts.URL, fp, DownloadOptions{Checksum: true})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if n != c.n || rangeHeaders[len(rangeHeaders)-1] != c.rng {
+			t.Errorf("%s: downloaded %d bytes with range %q, want %d with %q",
+				c.name, n, rangeHeaders[len(rangeHeaders)-1], c.n, c.rng)
+		}
+		if data, _ := ioutil.ReadFile(fp); !bytes.Equal(data, content) {
+			t.Errorf("%s: content == %q", c.name, data)
+		}
+		if sum, _ := ReadChecksum(fp); sum != hex.EncodeToString(want[:]) {
+			t.Errorf("%s: checksum == %q, want %x", c.name, sum, want)
+		}
+		if files, _ := ioutil.ReadDir(filepath.Dir(fp)); len(files) != 2 {
+			t.Errorf("%s: %d files left, want file and its checksum", c.name, len(files))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/kennygrant/sanitize"
+)
+
+// extensions - preferred extensions of common content types,
+// mime.ExtensionsByType gives odd ones like `.jfif` for jpeg
+var extensions = map[string]string{
+	"image/jpeg":               ".jpg",
+	"image/png":                ".png",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/bmp":                ".bmp",
+	"image/tiff":               ".tiff",
+	"image/svg+xml":            ".svg",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	"video/mp4":                ".mp4",
+	"video/webm":               ".webm",
+	"audio/mpeg":               ".mp3",
+	"application/pdf":          ".pdf",
+	"application/zip":          ".zip",
+	"application/json":         ".json",
+	"text/html":                ".html",
+	"text/plain":               ".txt",
+}
+
+var validExt = regexp.MustCompile(`^\.[[:alnum:]]{1,5}$`)
+
+// ResourceName - file name of resource at rawURL, split into sanitized name and
+// extension, which is empty if the url path has none. The name is the last element
+// of the path followed by a hash of the url without fragment, so that resources of
+// the same base name, e.g. `a.com/2018/1.jpg`, `b.com/2019/1.jpg` or CDN thumbnails
+// differing by query, don't collide. The same url always gets the same name, which
+// is never empty.
+func ResourceName(rawURL string) (name, ext string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return urlHash(rawURL), ""
+	}
+	u.Fragment = ""
+	hash := urlHash(u.String())
+
+	name, ext = baseName(u)
+	if name == "" {
+		return hash, ext
+	}
+	return name + "-" + hash, ext
+}
+
+// baseName - sanitized last element of path of u split into name and extension,
+// either may be empty
+func baseName(u *url.URL) (name, ext string) {
+	base := path.Base(u.Path)
+	if base == "/" || base == "." {
+		base = ""
+	}
+
+	ext = path.Ext(base)
+	if validExt.MatchString(ext) {
+		base = strings.TrimSuffix(base, ext)
+		ext = strings.ToLower(ext)
+	} else {
+		ext = ""
+	}
+
+	return strings.Trim(sanitize.BaseName(base), "-"), ext
+}
+
+// DetectExtension - extension of content by its `Content-Type`, or by magic
+// bytes of head if the type is missing or generic. Empty if unknown.
+func DetectExtension(contentType string, head []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" || mediaType == "binary/octet-stream" {
+		mediaType = ""
+	}
+
+	if mediaType == "" && len(head) > 0 {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+		if mediaType == "application/octet-stream" {
+			return ""
+		}
+	}
+
+	if ext, ok := extensions[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// urlHash - short hash of url, stable across runs
+func urlHash(rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResourceName(t *testing.T) {
+	cases := []struct {
+		url  string
+		name string
+		ext  string
+	}{
+		{"http://a.com/path/to/Some.JPEG", "Some-" + urlHash("http://a.com/path/to/Some.JPEG"), ".jpeg"},
+		{"http://a.com/img/photo.jpg?imageMogr2/thumbnail/200x", "photo-" + urlHash("http://a.com/img/photo.jpg?imageMogr2/thumbnail/200x"), ".jpg"},
+		{"http://a.com/img/a b:c.png#top", "a-b-c-" + urlHash("http://a.com/img/a%20b:c.png"), ".png"},
+		{"http://a.com/img/noext", "noext-" + urlHash("http://a.com/img/noext"), ""},
+		{"http://a.com/img/v1.2.3_final", "v1-2-3-final-" + urlHash("http://a.com/img/v1.2.3_final"), ""},
+		{"http://a.com/", urlHash("http://a.com/"), ""},
+		{"http://a.com/图片.gif", urlHash("http://a.com/%E5%9B%BE%E7%89%87.gif"), ".gif"},
+	}
+
+	for _, c := range cases {
+		name, ext := ResourceName(c.url)
+		if name != c.name || ext != c.ext {
+			t.Errorf("ResourceName(%q) == %q, %q, want %q, %q", c.url, name, ext, c.name, c.ext)
+		}
+	}
+}
+
+func TestResourceNameUnique(t *testing.T) {
+	urls := []string{
+		"http://a.com/x/1.jpg",
+		"http://b.com/y/1.jpg",
+		"http://a.com/2018/abc.jpg",
+		"http://a.com/2019/abc.jpg",
+		"http://a.com/2019/abc.jpg?w=200",
+	}
+
+	names := make(map[string]string)
+	for _, u := range urls {
+		name, _ := ResourceName(u)
+		if other, ok := names[name]; ok {
+			t.Errorf("ResourceName(%q) == ResourceName(%q) == %q", u, other, name)
+		}
+		names[name] = u
+	}
+
+	// fragment doesn't tell a different resource
+	if a, _ := ResourceName("http://a.com/x/1.jpg#top"); a != "1-"+urlHash("http://a.com/x/1.jpg") {
+		t.Errorf("name with fragment == %q", a)
+	}
+}
+
+func TestDetectExtension(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	cases := []struct {
+		contentType string
+		head        []byte
+		want        string
+	}{
+		{"image/jpeg", nil, ".jpg"},
+		{"image/webp; charset=binary", nil, ".webp"},
+		{"application/octet-stream", png, ".png"},
+		{"", []byte("GIF89a"), ".gif"},
+		{"", []byte{0, 1, 2, 3}, ""},
+	}
+
+	for _, c := range cases {
+		if got := DetectExtension(c.contentType, c.head); got != c.want {
+			t.Errorf("DetectExtension(%q, %q) == %q, want %q", c.contentType, c.head, got, c.want)
+		}
+	}
+}
+
+func TestDownloadResource(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("GIF89a......"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &http.Client{}
+	url := ts.URL + "/img/pic?w=200"
+
+	fp, _, err := DownloadResource(client, url, dir, DownloadOptions{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, _ := ResourceName(url)
+	if want := filepath.Join(dir, name+".gif"); fp != want || !strings.HasPrefix(name, "pic-") {
+		t.Errorf("DownloadResource(%q) == %q, want %q", url, fp, want)
+	}
+
+	// found with detected extension, not downloaded again
+	again, n, err := DownloadResource(client, url, dir, DownloadOptions{})
+	if err != nil || again != fp || n != 0 || hits != 1 {
+		t.Errorf("second download == %q, %d, %v with %d hits, want %q, 0, nil with 1 hit", again, n, err, hits, fp)
+	}
+}
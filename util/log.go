@@ -0,0 +1,39 @@
+package util
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogLevel - level shared by all loggers created with NewLogger
+var LogLevel = zap.NewAtomicLevelAt(zap.DebugLevel)
+
+// NewLogger - create logger in the same format as `zap.NewExample`, but
+// writing to stderr and filtered by LogLevel, so it can be tuned at runtime
+func NewLogger() *zap.Logger {
+	encoderCfg := zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderCfg), zapcore.Lock(os.Stderr), LogLevel)
+	return zap.New(core)
+}
+
+var logger = NewLogger().Sugar()
+
+// SetLogLevel - set level of all loggers created with NewLogger,
+// level is one of `debug`, `info`, `warn`, `error`
+func SetLogLevel(level string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	LogLevel.SetLevel(l)
+	return nil
+}
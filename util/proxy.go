@@ -0,0 +1,345 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoProxy - all proxies of the pool are out of rotation
+var ErrNoProxy = errors.New("no proxy available")
+
+// BanError - response looks like a ban page, e.g. captcha or firewall
+type BanError struct {
+	URL   string
+	Proxy string
+}
+
+func (e *BanError) Error() string {
+	return fmt.Sprintf("banned by site: %s via proxy %s", e.URL, e.Proxy)
+}
+
+// Default settings of ProxyPool
+const (
+	DefaultMaxProxyFailures = 3
+	DefaultProxyRecheck     = 5 * time.Minute
+)
+
+// proxyProbeTimeout - timeout of a health check request through a proxy
+const proxyProbeTimeout = 30 * time.Second
+
+// ProxyPool - rotate requests through proxies in round-robin order.
+// A proxy failing MaxFailures times in a row is taken out of rotation.
+// If CheckURL is set, proxies out of rotation are checked in the background
+// every Recheck by requesting CheckURL through them, and those answering are
+// put back. Otherwise a proxy is put back for a trial request after Recheck.
+type ProxyPool struct {
+	MaxFailures int
+	Recheck     time.Duration
+	CheckURL    string
+
+	// a response is taken as a ban if its status is in BanStatus, or its
+	// redirect location or body contains one of BanPatterns
+	BanStatus   []int
+	BanPatterns []string
+
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+	// health check is running, until no proxy is out of rotation
+	checking bool
+}
+
+type proxyState struct {
+	url      *url.URL
+	failures int
+	down     bool
+	downAt   time.Time
+	trial    bool
+}
+
+// NewProxyPool - create pool of given proxy urls, e.g. `http://127.0.0.1:8080`
+// or `socks5://127.0.0.1:1080`
+func NewProxyPool(proxies []string) (*ProxyPool, error) {
+	p := &ProxyPool{
+		MaxFailures: DefaultMaxProxyFailures,
+		Recheck:     DefaultProxyRecheck,
+	}
+
+	for _, raw := range proxies {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", raw)
+		}
+		p.proxies = append(p.proxies, &proxyState{url: u})
+	}
+
+	if len(p.proxies) == 0 {
+		return nil, errors.New("proxy list is empty")
+	}
+
+	return p, nil
+}
+
+// LoadProxyFile - read proxies from file, one per line,
+// blank lines and lines starting with `#` are skipped
+func LoadProxyFile(fp string) ([]string, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var proxies []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+
+	return proxies, scanner.Err()
+}
+
+// pick - next proxy in rotation
+func (p *ProxyPool) pick() (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for k := 0; k < len(p.proxies); k++ {
+		s := p.proxies[(p.next+k)%len(p.proxies)]
+		if s.down {
+			// one trial request at a time once recheck is due,
+			// unless proxies are put back by health check
+			if p.CheckURL != "" || s.trial || now.Sub(s.downAt) < p.Recheck {
+				continue
+			}
+			s.trial = true
+		}
+
+		p.next = (p.next + k + 1) % len(p.proxies)
+		return s.url, nil
+	}
+
+	return nil, ErrNoProxy
+}
+
+// report - record result of a request through proxy, returns whether
+// the proxy is out of rotation
+func (p *ProxyPool) report(proxy *url.URL, failed bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.proxies {
+		if s.url != proxy {
+			continue
+		}
+
+		s.trial = false
+		if !failed {
+			if s.down {
+				logger.Infow("proxy back in rotation", "proxy", proxy.String())
+			}
+			s.failures = 0
+			s.down = false
+			return false
+		}
+
+		s.failures++
+		if s.down || s.failures >= p.MaxFailures {
+			if !s.down {
+				logger.Infow("proxy taken out of rotation", "proxy", proxy.String(), "failures", s.failures)
+			}
+			s.down = true
+			s.downAt = time.Now()
+
+			if p.CheckURL != "" && !p.checking {
+				p.checking = true
+				go p.healthCheck(p.Recheck)
+			}
+		}
+		return s.down
+	}
+
+	return false
+}
+
+// healthCheck - probe proxies out of rotation every interval, until all are back
+func (p *ProxyPool) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		down := p.down()
+		if len(down) == 0 {
+			return
+		}
+
+		for _, proxy := range down {
+			err := p.probe(proxy)
+			if err != nil {
+				logger.Infow("proxy health check failed", "proxy", proxy.String(), "error", err)
+			}
+			p.report(proxy, err != nil)
+		}
+	}
+}
+
+// down - proxies out of rotation, ends health check if there is none
+func (p *ProxyPool) down() []*url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var down []*url.URL
+	for _, s := range p.proxies {
+		if s.down {
+			down = append(down, s.url)
+		}
+	}
+	if len(down) == 0 {
+		p.checking = false
+	}
+	return down
+}
+
+// probe - request CheckURL through proxy, which fails on network errors,
+// error status and ban pages
+func (p *ProxyPool) probe(proxy *url.URL) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Transport: transport, Timeout: proxyProbeTimeout}
+	resp, err := client.Get(p.CheckURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if p.isBan(resp) {
+		return &BanError{URL: p.CheckURL, Proxy: proxy.String()}
+	}
+	return nil
+}
+
+// release - end trial of proxy without judging it
+func (p *ProxyPool) release(proxy *url.URL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.proxies {
+		if s.url == proxy {
+			s.trial = false
+		}
+	}
+}
+
+// isBan - whether response looks like a ban page, body is restored for later reads
+func (p *ProxyPool) isBan(resp *http.Response) bool {
+	for _, status := range p.BanStatus {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+
+	if len(p.BanPatterns) == 0 {
+		return false
+	}
+
+	location := resp.Header.Get("Location")
+	for _, pattern := range p.BanPatterns {
+		if location != "" && strings.Contains(location, pattern) {
+			return true
+		}
+	}
+
+	// only html pages are checked, so that downloads are kept streaming
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range p.BanPatterns {
+		if bytes.Contains(body, []byte(pattern)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type proxyKey struct{}
+
+// proxyTransport - send each request through next proxy of the pool
+type proxyTransport struct {
+	pool  *ProxyPool
+	base  *http.Transport
+	onUse func(proxy string, failed, down bool)
+}
+
+// ProxyTransport - transport rotating requests through proxies of pool.
+// Network errors and ban pages count as failures of the proxy, which are
+// returned as errors. onUse, if not nil, is called after each request.
+func ProxyTransport(pool *ProxyPool, onUse func(proxy string, failed, down bool)) http.RoundTripper {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		proxy, _ := req.Context().Value(proxyKey{}).(*url.URL)
+		return proxy, nil
+	}
+
+	return &proxyTransport{pool: pool, base: base, onUse: onUse}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy, err := t.pool.pick()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy)))
+
+	// failures due to cancellation are not the proxy's fault
+	if err != nil && req.Context().Err() != nil {
+		t.pool.release(proxy)
+		return nil, err
+	}
+
+	failed := err != nil
+	if err == nil && t.pool.isBan(resp) {
+		resp.Body.Close()
+		failed = true
+		err = &BanError{URL: req.URL.String(), Proxy: proxy.String()}
+	}
+
+	down := t.pool.report(proxy, failed)
+	if t.onUse != nil {
+		t.onUse(proxy.String(), failed, down)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
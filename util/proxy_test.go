@@ -0,0 +1,152 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newProxy - fake http proxy answering every request itself with name
+func newProxy(name string, banned bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if banned {
+			fmt.Fprint(w, "<html>please input captcha</html>")
+			return
+		}
+		fmt.Fprint(w, name)
+	}))
+}
+
+func TestProxyTransport(t *testing.T) {
+	good := newProxy("good", false)
+	defer good.Close()
+	bad := newProxy("bad", true)
+	defer bad.Close()
+
+	pool, err := NewProxyPool([]string{good.URL, bad.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.MaxFailures = 2
+	pool.Recheck = time.Hour
+	pool.BanPatterns = []string{"captcha"}
+
+	uses := make(map[string]int)
+	failures := make(map[string]int)
+	client := &http.Client{Transport: ProxyTransport(pool, func(proxy string, failed, down bool) {
+		uses[proxy]++
+		if failed {
+			failures[proxy]++
+		}
+	})}
+
+	var bodies []string
+	for k := 0; k < 6; k++ {
+		body, err := GetContentWith(client, "http://example.com/page")
+		if err == nil {
+			bodies = append(bodies, string(body))
+		}
+	}
+
+	// bad proxy is taken out after 2 ban pages, the rest go through good one
+	if uses[bad.URL] != 2 || failures[bad.URL] != 2 || uses[good.URL] != 4 || len(bodies) != 4 {
+		t.Errorf("unexpected proxy use: uses=%v failures=%v bodies=%v", uses, failures, bodies)
+	}
+
+	// bad proxy is back for a trial once recheck is due
+	pool.Recheck = 0
+	for k := 0; k < 2; k++ {
+		GetContentWith(client, "http://example.com/page")
+	}
+	if uses[bad.URL] != 3 {
+		t.Errorf("expect bad proxy rechecked once, got %d uses", uses[bad.URL])
+	}
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	var mu sync.Mutex
+	healthy := false
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !healthy {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer proxy.Close()
+
+	pool, err := NewProxyPool([]string{proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.MaxFailures = 1
+	pool.Recheck = 10 * time.Millisecond
+	pool.CheckURL = "http://example.com/health"
+	pool.BanStatus = []int{http.StatusBadGateway}
+
+	client := &http.Client{Transport: ProxyTransport(pool, nil)}
+	if _, err := GetContentWith(client, "http://example.com/"); err == nil {
+		t.Fatal("expect error through proxy down")
+	}
+
+	// no trial request is made while the proxy fails health check
+	time.Sleep(50 * time.Millisecond)
+	if _, err := GetContentWith(client, "http://example.com/"); err == nil || !strings.Contains(err.Error(), ErrNoProxy.Error()) {
+		t.Errorf("request while proxy fails health check: %v", err)
+	}
+
+	// put back once it answers health check
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if body, err := GetContentWith(client, "http://example.com/"); err != nil || string(body) != "ok" {
+		t.Errorf("request after proxy is healthy == %q, %v", body, err)
+	}
+}
+
+func TestNoProxyAvailable(t *testing.T) {
+	pool, err := NewProxyPool([]string{"http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.MaxFailures = 1
+
+	client := &http.Client{Transport: ProxyTransport(pool, nil)}
+	if _, err = GetContentWith(client, "http://example.com/"); err == nil {
+		t.Fatal("expect error through unreachable proxy")
+	}
+	if _, err = GetContentWith(client, "http://example.com/"); err == nil {
+		t.Fatal("expect error without available proxy")
+	}
+}
+
+func TestLoadProxyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "proxies.txt")
+	ioutil.WriteFile(fp, []byte("# comment\nhttp://1.2.3.4:80\n\n socks5://5.6.7.8:1080 \n"), 0600)
+
+	proxies, err := LoadProxyFile(fp)
+	if err != nil || len(proxies) != 2 || proxies[1] != "socks5://5.6.7.8:1080" {
+		t.Errorf("unexpected proxies: %v, %v", proxies, err)
+	}
+
+	if _, err = NewProxyPool([]string{"not a proxy"}); err == nil {
+		t.Error("expect error for invalid proxy")
+	}
+}
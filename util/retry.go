@@ -0,0 +1,157 @@
+package util
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy - when and how long to wait before a failed request is sent again
+type RetryPolicy struct {
+	// max number of attempts including the first one, less than 2 means no retry
+	MaxAttempts int
+	// wait before the first retry, doubled after each retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// wait is randomized by ±Jitter of itself, in [0, 1]
+	Jitter float64
+	// responses with these status codes are retried, as well as network errors
+	RetryStatus []int
+}
+
+// DefaultRetryPolicy - used for sections without retry settings
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     time.Second,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+	RetryStatus: []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// Wait - wait before n-th retry, starting from 1
+func (p RetryPolicy) Wait(n int) time.Duration {
+	wait := p.Backoff
+	for k := 1; k < n && wait < p.MaxBackoff; k++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		wait = time.Duration(float64(wait) * (1 - p.Jitter + 2*p.Jitter*rand.Float64()))
+	}
+
+	return wait
+}
+
+func (p RetryPolicy) retryStatus(code int) bool {
+	for _, status := range p.RetryStatus {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTransport - send failed requests again as the policy says
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+// RetryTransport - wrap base transport, http.DefaultTransport if nil, to retry
+// requests failing with network errors or retryable status codes. `Retry-After`
+// of responses is honored, and no more retry is made if it exceeds MaxBackoff.
+// The last response or error is returned once attempts are used up.
+func RetryTransport(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, policy: policy}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+
+		if attempt >= t.policy.MaxAttempts || req.Context().Err() != nil || !t.retryable(req, resp, err) {
+			return resp, err
+		}
+
+		wait := t.policy.Wait(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if t.policy.MaxBackoff > 0 && after > t.policy.MaxBackoff {
+					return resp, err
+				}
+				if after > wait {
+					wait = after
+				}
+			}
+			resp.Body.Close()
+		}
+
+		logger.Infow("retry request", "url", req.URL.String(), "attempt", attempt, "wait", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+
+		// body has been consumed by the last attempt
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.WithContext(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func (t *retryTransport) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		// refused on purpose, sending again changes nothing
+		return err != ErrRobotsDisallowed && err != ErrNoProxy
+	}
+
+	return t.policy.retryStatus(resp.StatusCode)
+}
+
+// retryAfter - wait asked by `Retry-After` header, in seconds or http date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
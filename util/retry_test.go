@@ -0,0 +1,78 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte("ok"))
+		case "/later":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy
+	policy.Backoff = time.Millisecond
+	policy.MaxBackoff = 10 * time.Millisecond
+	client := &http.Client{Transport: RetryTransport(nil, policy)}
+
+	cases := []struct {
+		path   string
+		status int
+		hits   int32
+	}{
+		{"/flaky", http.StatusOK, 3},
+		{"/later", http.StatusServiceUnavailable, 1},
+		{"/missing", http.StatusNotFound, 1},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&hits, 0)
+		resp, err := client.Post(ts.URL+c.path, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status || atomic.LoadInt32(&hits) != c.hits {
+			t.Errorf("%s: expect status %d after %d hits, got %d after %d",
+				c.path, c.status, c.hits, resp.StatusCode, hits)
+		}
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for k, wait := range expected {
+		if got := p.Wait(k + 1); got != wait {
+			t.Errorf("Wait(%d) = %v, expect %v", k+1, got, wait)
+		}
+	}
+
+	p.Jitter = 0.5
+	for k := 0; k < 10; k++ {
+		if got := p.Wait(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Errorf("Wait(1) with jitter = %v, out of range", got)
+		}
+	}
+}
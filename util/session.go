@@ -0,0 +1,106 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Session - login session of a site. Login is done before the first request,
+// and done again once a response shows the session has expired.
+type Session struct {
+	// Login - log in by sending requests through rt, which keeps the cookies
+	Login func(ctx context.Context, rt http.RoundTripper) error
+	// Expired - whether resp shows the session is missing or expired,
+	// body must be restored if it is read
+	Expired func(resp *http.Response) bool
+
+	mu sync.Mutex
+	// number of successful logins, so that concurrent requests finding
+	// the same expired session trigger only one login
+	logins int
+	err    error
+}
+
+// login - log in unless another request has done it since `seen` logins
+func (s *Session) login(ctx context.Context, rt http.RoundTripper, seen int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.logins > seen {
+		return s.logins, nil
+	}
+	// failed login is not tried again by each request
+	if s.err != nil {
+		return s.logins, s.err
+	}
+
+	if s.err = s.Login(ctx, rt); s.err != nil {
+		logger.Infow("login error", "error", s.err)
+		return s.logins, s.err
+	}
+
+	s.logins++
+	logger.Infow("logged in", "logins", s.logins)
+	return s.logins, nil
+}
+
+func (s *Session) current() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// sessionTransport - keep requests in a logged-in session
+type sessionTransport struct {
+	base    http.RoundTripper
+	session *Session
+}
+
+// SessionTransport - wrap base transport, http.DefaultTransport if nil, to log in
+// session before the first request, and log in again and resend the request once
+// if its response shows the session has expired. base should keep cookies
+// set by responses, e.g. a HeaderTransport with a cookie jar.
+func SessionTransport(base http.RoundTripper, session *Session) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &sessionTransport{base: base, session: session}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	seen := t.session.current()
+	if seen == 0 {
+		var err error
+		if seen, err = t.session.login(req.Context(), t.base, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !t.session.Expired(resp) {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	logger.Infow("session expired", "url", req.URL.String())
+	if _, err = t.session.login(req.Context(), t.base, seen); err != nil {
+		return nil, err
+	}
+
+	if req.Body != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// contextTransport - bind every request to a context, so that requests are
+// refused once the context is done and in-flight requests are aborted
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+// ContextTransport - wrap base transport, http.DefaultTransport if nil,
+// to bind every request to ctx
+func ContextTransport(ctx context.Context, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &contextTransport{ctx: ctx, base: base}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// redirectTransport - tell redirects followed by the client
+type redirectTransport struct {
+	base http.RoundTripper
+	fn   func(from, to *url.URL)
+}
+
+// RedirectTransport - wrap base transport, http.DefaultTransport if nil,
+// to call fn with urls of each redirect before it is followed
+func RedirectTransport(base http.RoundTripper, fn func(from, to *url.URL)) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &redirectTransport{base: base, fn: fn}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// request created by the client to follow a redirect response
+	if req.Response != nil && req.Response.Request != nil {
+		t.fn(req.Response.Request.URL, req.URL)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ErrRobotsDisallowed - request refused since robots.txt of the host disallows it
+var ErrRobotsDisallowed = errors.New("URL blocked by robots.txt")
+
+// robotsTransport - refuse requests disallowed by robots.txt of their hosts
+type robotsTransport struct {
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	robots map[string]*robotstxt.RobotsData
+}
+
+// RobotsTransport - wrap base transport, http.DefaultTransport if nil,
+// to honor robots.txt, which is fetched once per host. Requests are allowed
+// if robots.txt can't be fetched.
+func RobotsTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &robotsTransport{base: base, robots: make(map[string]*robotstxt.RobotsData)}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != "/robots.txt" {
+		robots := t.get(req)
+		if robots != nil && !robots.TestAgent(req.URL.EscapedPath(), req.UserAgent()) {
+			return nil, ErrRobotsDisallowed
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *robotsTransport) get(req *http.Request) *robotstxt.RobotsData {
+	host := req.URL.Scheme + "://" + req.URL.Host
+
+	t.mu.Lock()
+	robots, ok := t.robots[host]
+	t.mu.Unlock()
+	if ok {
+		return robots
+	}
+
+	robotsReq, err := http.NewRequest("GET", host+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	robotsReq.Header.Set("User-Agent", req.UserAgent())
+
+	resp, err := t.base.RoundTrip(robotsReq.WithContext(req.Context()))
+	if err != nil {
+		logger.Infow("fetch robots.txt error", "host", host, "error", err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		robots, err = robotstxt.FromStatusAndBytes(resp.StatusCode, body)
+	}
+	if err != nil {
+		logger.Infow("parse robots.txt error", "host", host, "error", err)
+		return nil
+	}
+
+	t.mu.Lock()
+	t.robots[host] = robots
+	t.mu.Unlock()
+
+	return robots
+}
+
+// delayTransport - wait a random delay before each request
+type delayTransport struct {
+	base  http.RoundTripper
+	delay func(host string) time.Duration
+}
+
+// RandomDelayTransport - wrap base transport, http.DefaultTransport if nil,
+// to wait a random duration in [0, max(host)) before each request.
+// Waiting is aborted once the request's context is done.
+func RandomDelayTransport(base http.RoundTripper, max func(host string) time.Duration) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &delayTransport{base: base, delay: max}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *delayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if max := t.delay(req.URL.Host); max > 0 {
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(max))))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// headerTransport - set static headers, cookies and a rotating user agent on each request
+type headerTransport struct {
+	base       http.RoundTripper
+	header     http.Header
+	cookie     string
+	userAgents []string
+	jar        http.CookieJar
+
+	next uint32
+}
+
+// HeaderTransport - wrap base transport, http.DefaultTransport if nil, to set
+// header on each request, rotate `User-Agent` through userAgents if any, and
+// send cookie, a `name=value; ...` string, along with cookies of jar.
+// Cookies set by responses are stored in jar if it is not nil.
+func HeaderTransport(base http.RoundTripper, header http.Header, cookie string, userAgents []string, jar http.CookieJar) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &headerTransport{base: base, header: header, cookie: cookie, userAgents: userAgents, jar: jar}
+}
+
+// RoundTrip - implement http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// request must not be modified by transport
+	req = req.Clone(req.Context())
+
+	for key, values := range t.header {
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	if len(t.userAgents) > 0 {
+		n := atomic.AddUint32(&t.next, 1) - 1
+		req.Header.Set("User-Agent", t.userAgents[int(n)%len(t.userAgents)])
+	}
+
+	var cookies []string
+	if old := req.Header.Get("Cookie"); old != "" {
+		cookies = append(cookies, old)
+	}
+	if t.jar != nil {
+		for _, c := range t.jar.Cookies(req.URL) {
+			cookies = append(cookies, c.Name+"="+c.Value)
+		}
+	}
+	if t.cookie != "" {
+		cookies = append(cookies, t.cookie)
+	}
+	if len(cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.jar != nil {
+		if rc := readSetCookies(resp.Header); len(rc) > 0 {
+			t.jar.SetCookies(req.URL, rc)
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextTransport(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &http.Client{Transport: ContextTransport(ctx, nil)}
+
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	cancel()
+	if _, err = client.Get(ts.URL); err == nil {
+		t.Error("request after cancel should fail")
+	}
+
+	if hits != 1 {
+		t.Errorf("server hits == %d, want 1", hits)
+	}
+}
+
+func TestHeaderTransport(t *testing.T) {
+	var agents, cookies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		if r.Header.Get("Referer") != "http://example.com/" {
+			t.Errorf("Referer == %q", r.Header.Get("Referer"))
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+	}))
+	defer ts.Close()
+
+	jar, _ := NewCookieJar("")
+	header := http.Header{"Referer": {"http://example.com/"}}
+	client := &http.Client{Transport: HeaderTransport(nil, header, "a=b", []string{"ua1", "ua2"}, jar)}
+
+	for k := 0; k < 3; k++ {
+		res, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	wantAgents := []string{"ua1", "ua2", "ua1"}
+	wantCookies := []string{"a=b", "sid=1; a=b", "sid=1; a=b"}
+	for k := range wantAgents {
+		if agents[k] != wantAgents[k] || cookies[k] != wantCookies[k] {
+			t.Errorf("request #%d has user agent %q and cookie %q, want %q and %q",
+				k+1, agents[k], cookies[k], wantAgents[k], wantCookies[k])
+		}
+	}
+}
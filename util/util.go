@@ -2,52 +2,26 @@
 package util
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 )
 
-var client = &fasthttp.Client{}
-
-// Download download files from given url
-func Download(url, fp string, overwrite bool) error {
-	if exists, _ := Exists(fp); exists && !overwrite {
-		return nil
-	}
-	file, err := CreateFile(fp)
-	if err != nil {
-		return err
-	}
-
-	statusCode, body, err := client.Get(nil, url)
-	if err != nil {
-		return err
-	}
-
-	if statusCode != fasthttp.StatusOK {
-		return fmt.Errorf("Status Code Is Not %d", fasthttp.StatusOK)
-	}
-
-	_, err = file.Write(body)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// FilenameFromURL -- get file name from url, where url is in form of 'http://..../filename'
+// FilenameFromURL -- get file name from url, where url is in form of 'http://..../filename',
+// see ResourceName for how the name is derived
 func FilenameFromURL(url string) string {
-	ss := strings.Split(url, "/")
-	return ss[len(ss)-1]
+	name, ext := ResourceName(url)
+	return name + ext
 }
 
 // CreateFile - create file anyway, if file exists, empty it and return
@@ -56,7 +30,7 @@ func CreateFile(fp string) (*os.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return os.OpenFile(fp, os.O_WRONLY|os.O_CREATE, 0600)
+	return os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 }
 
 // Exists returns whether the given file or directory exists or not
@@ -112,45 +86,99 @@ func LogProcessTime(logger *zap.Logger, startT time.Time) {
 	logger.Info("", zap.String("process time", endT.Sub(startT).String()))
 }
 
-// GetContent - get content directed by url
-func GetContent(url string) ([]byte, error) {
-	statusCode, body, err := client.Get(nil, url)
-
+// GetContentWith - get content directed by url with client, e.g. one made by
+// basic.NewHTTPClient rotating through proxies
+func GetContentWith(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if statusCode != fasthttp.StatusOK {
+	if resp.StatusCode != http.StatusOK {
 		return nil, errors.New("Status Code Is Not OK")
 	}
 
-	return body, nil
+	return ioutil.ReadAll(resp.Body)
 }
 
-// GetResourceName - get resource name in uri
+// GetResourceName - get resource name in uri, the sanitized last element of its
+// path without extension, e.g. `123` of `http://a.com/i/123.html?from=list`.
+// Unlike ResourceName no hash is added, so it stays the same as ids in urls, and
+// is only the hash of uri if the path gives no name.
 func GetResourceName(uri string) (string, error) {
-	rawURL, err := url.Parse(uri)
+	u, err := url.Parse(uri)
 	if err != nil {
 		return "", err
 	}
 
-	strs := strings.Split(rawURL.Path, "/")
-	lastItem := strs[len(strs)-1]
-
-	return strings.Split(lastItem, ".")[0], nil
+	if name, _ := baseName(u); name != "" {
+		return name, nil
+	}
+	u.Fragment = ""
+	return urlHash(u.String()), nil
 }
 
-// GetResourceSuffix - get resource suffix in uri, including `.`
+// GetResourceSuffix - get resource suffix in uri, including `.`,
+// empty if the path has no extension
 func GetResourceSuffix(uri string) (string, error) {
-
-	rawURL, err := url.Parse(uri)
+	u, err := url.Parse(uri)
 	if err != nil {
 		return "", err
 	}
 
-	strs := strings.Split(rawURL.Path, "/")
-	lastItem := strs[len(strs)-1]
-	subItems := strings.Split(lastItem, ".")
+	_, ext := baseName(u)
+	return ext, nil
+}
+
+// DirSize - total size of regular files under given directory,
+// zero if the directory doesn't exist
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// ForEachLimit - call fn for each item in its own goroutine, with at most
+// limit calls running at the same time, and wait for all to finish.
+// limit < 1 means no limit. No more call is started once ctx is done.
+func ForEachLimit(ctx context.Context, items []string, limit int, fn func(item string)) {
+	if limit < 1 {
+		limit = len(items)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+
+		go func(it string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(it)
+		}(item)
+	}
 
-	return "." + subItems[len(subItems)-1], nil
+	wg.Wait()
 }
@@ -1,10 +1,13 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -46,7 +49,7 @@ func TestWriteOnly(t *testing.T) {
 func TestDownload(t *testing.T) {
 	url := "https://previews.123rf.com/images/benjaminboeckle/benjaminboeckle1611/benjaminboeckle161100512/67028130-Cape-of-good-Hope-in-South-Africa-Stock-Photo.jpg"
 	filename := FilenameFromURL(url)
-	err := Download(url, "tmp/"+filename, true)
+	_, err := DownloadWith(&http.Client{}, url, "tmp/"+filename, true)
 	log.Println(err)
 }
 
@@ -107,3 +110,46 @@ func TestGetResourceSuffix(t *testing.T) {
 	uri := "http://localhost:8080/path/to/some.jpeg?hello"
 	log.Println(GetResourceSuffix(uri))
 }
+
+func TestForEachLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, count := 0, 0, 0
+
+	items := []string{"a", "b", "c", "d", "e", "f"}
+	ForEachLimit(context.Background(), items, 2, func(item string) {
+		mu.Lock()
+		running++
+		count++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	if count != len(items) {
+		t.Errorf("ForEachLimit called fn %d times, want %d", count, len(items))
+	}
+	if maxRunning > 2 {
+		t.Errorf("ForEachLimit ran %d calls at once, want at most 2", maxRunning)
+	}
+}
+
+func TestForEachLimitCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	count := 0
+	ForEachLimit(ctx, []string{"a", "b", "c"}, 1, func(item string) {
+		count++
+		cancel()
+	})
+
+	if count != 1 {
+		t.Errorf("ForEachLimit called fn %d times after cancel, want 1", count)
+	}
+}